@@ -1,8 +1,59 @@
 :- op(501, xfx, -&-).
 :- built_in(list_tables/1).
+:- built_in(list_tables/2).
+:- built_in(describe_table/2).
+:- built_in(describe_table/3).
+:- built_in(create_table/2).
+:- built_in(create_table/3).
+:- built_in(delete_table/1).
+:- built_in(delete_table/2).
+:- built_in(wait_table/2).
+:- built_in(wait_table/3).
 :- built_in(scan/2).
+:- built_in(scan/3).
+:- built_in(scan_page/4).
 :- built_in(get_item/3).
-% :- built_in(query/3).
+:- built_in(get_item/4).
+:- built_in(query/3).
+:- built_in(query/4).
+:- built_in(index_query/4).
+:- built_in(index_query/5).
 :- built_in(put_item/2).
+:- built_in(put_item/3).
+:- built_in(update_item/3).
+:- built_in(update_item/4).
+:- built_in(update_item/5).
 :- built_in(delete_item/2).
+:- built_in(delete_item/3).
+:- built_in(batch_get_item/3).
+:- built_in(batch_get_item/4).
+:- built_in(batch_write/2).
+:- built_in(batch_write/3).
+:- built_in(transact/1).
+:- built_in(transact/2).
+:- built_in(transact_get/2).
+:- built_in(transact_get/3).
+:- built_in(execute_statement/3).
+:- built_in(execute_statement/4).
+:- built_in(stream_record/2).
+:- built_in(stream_record/3).
+:- built_in(export_table/2).
+:- built_in(export_table/3).
+:- built_in(import_table/2).
+:- built_in(import_table/3).
+:- built_in(dynamo_schema/2).
+:- built_in(dynamo_fact/3).
+:- built_in(dynamo_assert/1).
+:- built_in(dynamo_retract/1).
+:- built_in('$dynamo_table'/3).
+:- built_in(dynamo_stats/1).
 :- built_in(attribute_value/2).
+
+% dynamo_table(+Name/Arity, +Table, +Attrs) defines Name/Arity as the items of Table, see dynamo_fact/3.
+:- built_in(dynamo_table/3).
+dynamo_table(Name/Arity, Table, Attrs) :-
+	'$dynamo_table'(Name/Arity, Table, Attrs),
+	functor(Head, Name, Arity),
+	Head =.. [Name|Values],
+	retractall(Head),
+	assertz((Head :- dynamo_fact(Table, Attrs, Values))).
@@ -0,0 +1,208 @@
+package dynamodb
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+// CacheStats counts the get_item lookups answered by the item cache (Hits)
+// and those that had to read from DynamoDB (Misses). Consistent reads aren't counted.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// itemCache is a size-bounded LRU cache of the items read by get_item, whose entries expire after a TTL.
+// Missing items are cached too, so repeated lookups of a key that doesn't exist don't hit DynamoDB.
+// A nil *itemCache caches nothing.
+type itemCache struct {
+	mu   sync.Mutex
+	size int
+	ttl  time.Duration
+	// of *cacheEntry, most recently used first
+	lru     *list.List
+	entries map[string]*list.Element
+	// entries by table, for invalidation
+	tables map[string]map[string]*list.Element
+	stats  CacheStats
+}
+
+type cacheEntry struct {
+	id    string
+	table string
+	key   itemKey
+	// nil if the item doesn't exist
+	item    map[string]*dynamodb.AttributeValue
+	expires time.Time
+}
+
+func newItemCache(size int, ttl time.Duration) *itemCache {
+	return &itemCache{
+		size:    size,
+		ttl:     ttl,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		tables:  make(map[string]map[string]*list.Element),
+	}
+}
+
+// cacheID returns a string uniquely identifying the item of table with the given key.
+// Numbers are normalized by itemKey.String, so writes to n('1.0') invalidate the entry for n(1).
+func cacheID(table string, key itemKey) string {
+	return table + "\x00" + key.pk + "\x00" + key.sk + "\x00" + key.String()
+}
+
+// get returns the cached item for key, if any. A nil item with ok = true means the item doesn't exist.
+func (c *itemCache) get(table string, key itemKey, now time.Time) (item map[string]*dynamodb.AttributeValue, ok bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[cacheID(table, key)]
+	if ok && now.After(elem.Value.(*cacheEntry).expires) {
+		c.remove(elem)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).item, true
+}
+
+// add caches item (nil if it doesn't exist) for key, evicting the least recently used entry if the cache is full.
+func (c *itemCache) add(table string, key itemKey, item map[string]*dynamodb.AttributeValue, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := cacheID(table, key)
+	if elem, ok := c.entries[id]; ok {
+		c.remove(elem)
+	}
+	elem := c.lru.PushFront(&cacheEntry{
+		id:      id,
+		table:   table,
+		key:     key,
+		item:    item,
+		expires: now.Add(c.ttl),
+	})
+	c.entries[id] = elem
+	if c.tables[table] == nil {
+		c.tables[table] = make(map[string]*list.Element)
+	}
+	c.tables[table][id] = elem
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate removes the cached entries of table whose key matches item, which can be a whole item or just its key.
+func (c *itemCache) invalidate(table string, item map[string]*dynamodb.AttributeValue) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, elem := range c.tables[table] {
+		e := elem.Value.(*cacheEntry)
+		key := itemKey{pk: e.key.pk, pv: item[e.key.pk], sk: e.key.sk, sv: item[e.key.sk]}
+		if key.pv == nil || (key.sk != "" && key.sv == nil) {
+			continue
+		}
+		if key.String() == e.key.String() {
+			c.remove(elem)
+		}
+	}
+}
+
+// purge removes every cached entry of table.
+func (c *itemCache) purge(table string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, elem := range c.tables[table] {
+		c.remove(elem)
+	}
+}
+
+func (c *itemCache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, e.id)
+	delete(c.tables[e.table], e.id)
+	if len(c.tables[e.table]) == 0 {
+		delete(c.tables, e.table)
+	}
+}
+
+func (c *itemCache) counts() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// get returns the item of table with the given key, or nil if it doesn't exist.
+// Unless consistent is true, the item might come from the cache.
+func (d Dynamo) get(ctx context.Context, table string, key itemKey, consistent bool) (map[string]*dynamodb.AttributeValue, error) {
+	if !consistent {
+		if item, ok := d.cache.get(table, key, time.Now()); ok {
+			return item, nil
+		}
+	}
+
+	q := d.db.Table(table).Get(key.pk, key.pv).Consistent(consistent)
+	if key.sk != "" {
+		q.Range(key.sk, dynamo.Equal, key.sv)
+	}
+	var item map[string]*dynamodb.AttributeValue
+	err := q.OneWithContext(ctx, &item)
+	if err == dynamo.ErrNotFound {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.cache.add(table, key, item, time.Now())
+	return item, nil
+}
+
+// cachedWrite is a key or item written to table, whose cached entry becomes stale.
+type cachedWrite struct {
+	table string
+	item  map[string]*dynamodb.AttributeValue
+}
+
+// written invalidates the cached entries of the given writes.
+// Writes are invalidated even if they failed, as a request that timed out might have succeeded anyway.
+func (c *itemCache) written(writes []cachedWrite) {
+	for _, w := range writes {
+		c.invalidate(w.table, w.item)
+	}
+}
+
+// item returns key as an item with only the key attributes.
+func (key itemKey) item() map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{key.pk: key.pv}
+	if key.sk != "" {
+		item[key.sk] = key.sv
+	}
+	return item
+}
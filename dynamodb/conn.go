@@ -0,0 +1,69 @@
+package dynamodb
+
+import (
+	"github.com/ichiban/prolog/engine"
+)
+
+// WithConnection returns a copy of d that can also use conn, addressing its tables as Name:Table.
+// This lets one interpreter use several accounts or regions, such as reading prod:users and writing staging:users.
+// Tables without a connection name use d. Options such as WithPlainValues and WithCache apply per connection.
+//
+//	ddb := dynamodb.New(db).
+//		WithConnection("prod", dynamodb.New(dynamo.New(sess, &aws.Config{Region: aws.String("us-east-1")}))).
+//		WithConnection("staging", dynamodb.New(dynamo.New(sess, &aws.Config{Region: aws.String("eu-west-1")})))
+func (d Dynamo) WithConnection(name string, conn Dynamo) Dynamo {
+	conns := make(map[string]Dynamo, len(d.conns)+1)
+	for k, v := range d.conns {
+		conns[k] = v
+	}
+	conn.name = name
+	if d.metrics != nil {
+		conn = conn.metered(d.metrics)
+	}
+	conns[name] = conn
+	d.conns = conns
+	return d
+}
+
+// qualified splits t into its connection and the rest if it's in Conn:T form, otherwise it returns d and t.
+// Unknown connections throw error(existence_error(connection, Conn), _).
+func (d Dynamo) qualified(t engine.Term, env *engine.Env) (Dynamo, engine.Term, error) {
+	cmp, ok := env.Resolve(t).(engine.Compound)
+	if !ok || cmp.Functor() != ":" || cmp.Arity() != 2 {
+		return d, t, nil
+	}
+	name, err := atomArg(cmp.Arg(0), env)
+	if err != nil {
+		return d, nil, err
+	}
+	conn, ok := d.conns[name]
+	if !ok {
+		return d, nil, existenceError("connection", engine.Atom(name), env)
+	}
+	// requests through conn are made for the same predicate
+	conn.pi = d.pi
+	return conn, cmp.Arg(1), nil
+}
+
+// resolve returns the connection and name of the table t, which is Table or Conn:Table.
+func (d Dynamo) resolve(t engine.Term, env *engine.Env) (Dynamo, string, error) {
+	conn, t, err := d.qualified(t, env)
+	if err != nil {
+		return d, "", err
+	}
+	name, err := tableName(t, env)
+	return conn, name, err
+}
+
+// connection returns the connection with the given name, or d if name is empty.
+func (d Dynamo) connection(name string) Dynamo {
+	if name == "" {
+		return d
+	}
+	return d.conns[name]
+}
+
+// sameConn reports whether a and b use the same DynamoDB client, as is required for transactions.
+func sameConn(a, b Dynamo) bool {
+	return a.db == b.db
+}
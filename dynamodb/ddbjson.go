@@ -0,0 +1,179 @@
+package dynamodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ichiban/prolog/engine"
+)
+
+// This file converts items to and from DynamoDB JSON, the format used by the DynamoDB API:
+//
+//	{"UserID": {"N": "42"}, "Tags": {"SS": ["a", "b"]}}
+//
+// Values go through their terms from av2prolog and prolog2av, so ss([s(a), s(b)]) is {"SS": ["a", "b"]}.
+
+func marshalItem(item map[string]*dynamodb.AttributeValue) ([]byte, error) {
+	obj, err := pairs2json(item2prolog(item))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
+
+func unmarshalItem(data []byte) (map[string]*dynamodb.AttributeValue, error) {
+	obj, err := json2pairs(data)
+	if err != nil {
+		return nil, err
+	}
+	av, err := prolog2av(engine.Atom("m").Apply(obj), nil)
+	if err != nil {
+		return nil, err
+	}
+	return av.M, nil
+}
+
+// term2json converts a value from av2prolog to DynamoDB JSON.
+func term2json(t engine.Term) (map[string]interface{}, error) {
+	c, ok := t.(engine.Compound)
+	if !ok || c.Arity() != 1 {
+		return nil, fmt.Errorf("empty attribute value")
+	}
+	typ := strings.ToUpper(string(c.Functor()))
+	switch c.Functor() {
+	case "s", "n", "b":
+		return map[string]interface{}{typ: string(c.Arg(0).(engine.Atom))}, nil
+	case "bool", "null":
+		return map[string]interface{}{typ: c.Arg(0) == engine.Atom("true")}, nil
+	case "ss", "ns", "bs":
+		set := []string{}
+		iter := engine.ListIterator{List: c.Arg(0)}
+		for iter.Next() {
+			set = append(set, string(iter.Current().(engine.Compound).Arg(0).(engine.Atom)))
+		}
+		return map[string]interface{}{typ: set}, iter.Err()
+	case "l":
+		list := []interface{}{}
+		iter := engine.ListIterator{List: c.Arg(0)}
+		for iter.Next() {
+			v, err := term2json(iter.Current())
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return map[string]interface{}{typ: list}, iter.Err()
+	case "m":
+		m, err := pairs2json(c.Arg(0))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{typ: m}, nil
+	}
+	return nil, fmt.Errorf("unknown attribute type: %s", typ)
+}
+
+// pairs2json converts a list of Key-Value pairs from av2prolog to an object of DynamoDB JSON values.
+func pairs2json(list engine.Term) (map[string]interface{}, error) {
+	obj := make(map[string]interface{})
+	iter := engine.ListIterator{List: list}
+	for iter.Next() {
+		key, val, err := splitkey(iter.Current(), nil)
+		if err != nil {
+			return nil, err
+		}
+		v, err := term2json(val)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", key, err)
+		}
+		obj[key] = v
+	}
+	return obj, iter.Err()
+}
+
+// json2term converts a value in DynamoDB JSON to its term, for prolog2av.
+func json2term(data []byte) (engine.Term, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	if len(obj) != 1 {
+		return nil, fmt.Errorf("attribute value must have exactly one type: %s", bytes.TrimSpace(data))
+	}
+
+	var typ string
+	var raw json.RawMessage
+	for typ, raw = range obj {
+		// the only type
+	}
+	functor := engine.Atom(strings.ToLower(typ))
+	switch typ {
+	case "S", "N", "B":
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return nil, err
+		}
+		return functor.Apply(engine.Atom(str)), nil
+	case "BOOL", "NULL":
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, err
+		}
+		if b {
+			return functor.Apply(engine.Atom("true")), nil
+		}
+		return functor.Apply(engine.Atom("false")), nil
+	case "SS", "NS", "BS":
+		var strs []string
+		if err := json.Unmarshal(raw, &strs); err != nil {
+			return nil, err
+		}
+		elem := engine.Atom(strings.ToLower(typ[:1]))
+		list := make([]engine.Term, 0, len(strs))
+		for _, str := range strs {
+			list = append(list, elem.Apply(engine.Atom(str)))
+		}
+		return functor.Apply(engine.List(list...)), nil
+	case "L":
+		var raws []json.RawMessage
+		if err := json.Unmarshal(raw, &raws); err != nil {
+			return nil, err
+		}
+		list := make([]engine.Term, 0, len(raws))
+		for _, raw := range raws {
+			v, err := json2term(raw)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return functor.Apply(engine.List(list...)), nil
+	case "M":
+		pairs, err := json2pairs(raw)
+		if err != nil {
+			return nil, err
+		}
+		return functor.Apply(pairs), nil
+	}
+	return nil, fmt.Errorf("unknown attribute type: %s", typ)
+}
+
+// json2pairs converts an object of DynamoDB JSON values to a list of Key-Value pairs.
+func json2pairs(data []byte) (engine.Term, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	list := make([]engine.Term, 0, len(obj))
+	for k, raw := range obj {
+		v, err := json2term(raw)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", k, err)
+		}
+		list = append(list, engine.Atom("-").Apply(engine.Atom(k), v))
+	}
+	return engine.List(list...), nil
+}
@@ -0,0 +1,48 @@
+package dynamodb
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDynamoJSON(t *testing.T) {
+	item := map[string]*dynamodb.AttributeValue{
+		"S":    {S: aws.String("hello")},
+		"N":    {N: aws.String("12345678901234567890.5")},
+		"B":    {B: []byte{1, 2, 3}},
+		"BOOL": {BOOL: aws.Bool(true)},
+		"NULL": {NULL: aws.Bool(true)},
+		"SS":   {SS: aws.StringSlice([]string{"a", "b"})},
+		"NS":   {NS: aws.StringSlice([]string{"1", "2.5"})},
+		"BS":   {BS: [][]byte{{1}, {2}}},
+		"L":    {L: []*dynamodb.AttributeValue{{S: aws.String("x")}, {N: aws.String("1")}}},
+		"M":    {M: map[string]*dynamodb.AttributeValue{"k": {S: aws.String("v")}}},
+	}
+
+	data, err := marshalItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := unmarshalItem(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(item, got); diff != "" {
+		t.Error("round trip mismatch (-want +got):\n", diff)
+	}
+
+	for _, bad := range []string{
+		`{"a": {}}`,
+		`{"a": {"S": "x", "N": "1"}}`,
+		`{"a": {"X": "1"}}`,
+		`{"a": {"N": "x"}}`,
+		`{"a": {"NULL": false}}`,
+	} {
+		if _, err := unmarshalItem([]byte(bad)); err == nil {
+			t.Error("expected error for:", bad)
+		}
+	}
+}
@@ -3,8 +3,16 @@ package dynamodb
 import (
 	"context"
 	_ "embed"
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
 	"github.com/guregu/dynamo"
 	"github.com/ichiban/prolog"
 	"github.com/ichiban/prolog/engine"
@@ -14,24 +22,130 @@ import (
 var bootstrap string
 
 type Dynamo struct {
-	db *dynamo.DB
+	db      *dynamo.DB
+	streams dynamodbstreamsiface.DynamoDBStreamsAPI
+	schemas *schemaCache
+	cache   *itemCache
+	fsys    fs.FS
+	decls   *declarations
+	facts   *factTables
+	// other connections by name, for tables written as Conn:Table
+	conns map[string]Dynamo
+	// name of this connection, empty for the default connection
+	name    string
+	metrics *metrics
+	// predicate indicator of the predicate making requests, for metrics
+	pi string
+	// return items as plain Prolog data instead of tagged attribute values
+	plain bool
 }
 
 func New(db *dynamo.DB) Dynamo {
 	d := Dynamo{
-		db: db,
+		db:      db,
+		schemas: newSchemaCache(),
+		decls:   newDeclarations(),
+		facts:   newFactTables(),
 	}
 	return d
 }
 
+// WithPlainValues returns a copy of d that returns items as plain Prolog data, as if converted by attribute_value/2.
+// Strings become atoms, numbers become numbers, lists and maps become lists, and sets become set(List), sorted.
+// Binary set elements are b(Base64), so string and binary sets can be told apart.
+// Values that would otherwise be ambiguous keep their wrappers: b(Base64), bool(Bool), null(true), m([]), and s('[]').
+func (d Dynamo) WithPlainValues() Dynamo {
+	d.plain = true
+	return d
+}
+
+// WithStreams returns a copy of d that reads table streams for stream_record/2 using the given DynamoDB Streams client,
+// such as dynamodbstreams.New(sess) or the fake from package dynamotest.
+func (d Dynamo) WithStreams(client dynamodbstreamsiface.DynamoDBStreamsAPI) Dynamo {
+	d.streams = client
+	return d
+}
+
+// WithFS returns a copy of d that uses fsys for the files of export_table/2 and import_table/2.
+// export_table/2 needs fsys to implement CreateFS, such as DirFS.
+func (d Dynamo) WithFS(fsys fs.FS) Dynamo {
+	d.fsys = fsys
+	return d
+}
+
+// WithCache returns a copy of d that caches up to size items read by get_item/3 and get_item/4 for ttl.
+// Items written by this package's put_item, update_item, delete_item, batch_write, and transact are invalidated,
+// but changes made by other clients can take up to ttl to show up. Use get_item/4 with consistent(true) to skip the cache.
+// A size of 0 disables caching.
+func (d Dynamo) WithCache(size int, ttl time.Duration) Dynamo {
+	d.cache = nil
+	if size > 0 {
+		d.cache = newItemCache(size, ttl)
+	}
+	return d
+}
+
+// CacheStats returns the number of cache hits and misses of get_item since the cache was created with WithCache.
+func (d Dynamo) CacheStats() CacheStats {
+	return d.cache.counts()
+}
+
+// NewFromIface creates a Dynamo using the given DynamoDB client,
+// such as the in-memory fake from package dynamotest.
+func NewFromIface(client dynamodbiface.DynamoDBAPI) Dynamo {
+	return New(dynamo.NewFromIface(client))
+}
+
 func (d Dynamo) Register(p *prolog.Interpreter) {
 	d.Bootstrap(p)
-	p.Register1("list_tables", d.ListTables)
-	p.Register2("scan", d.Scan)
-	p.Register3("get_item", d.GetItem)
-	// p.Register3("query", d.Query)
-	p.Register2("put_item", d.PutItem)
-	p.Register2("delete_item", d.DeleteItem)
+	p.Register1("list_tables", d.meter("list_tables/1").ListTables)
+	p.Register2("list_tables", d.meter("list_tables/2").ListTablesWithOptions)
+	p.Register2("describe_table", d.meter("describe_table/2").DescribeTable)
+	p.Register3("describe_table", d.meter("describe_table/3").DescribeTableWithOptions)
+	p.Register2("create_table", d.meter("create_table/2").CreateTable)
+	p.Register3("create_table", d.meter("create_table/3").CreateTableWithOptions)
+	p.Register1("delete_table", d.meter("delete_table/1").DeleteTable)
+	p.Register2("delete_table", d.meter("delete_table/2").DeleteTableWithOptions)
+	p.Register2("wait_table", d.meter("wait_table/2").WaitTable)
+	p.Register3("wait_table", d.meter("wait_table/3").WaitTableWithOptions)
+	p.Register2("scan", d.meter("scan/2").Scan)
+	p.Register3("scan", d.meter("scan/3").ScanWithOptions)
+	p.Register4("scan_page", d.meter("scan_page/4").ScanPage)
+	p.Register3("get_item", d.meter("get_item/3").GetItem)
+	p.Register4("get_item", d.meter("get_item/4").GetItemWithOptions)
+	p.Register3("query", d.meter("query/3").Query)
+	p.Register4("query", d.meter("query/4").QueryWithOptions)
+	p.Register4("index_query", d.meter("index_query/4").IndexQuery)
+	p.Register5("index_query", d.meter("index_query/5").IndexQueryWithOptions)
+	p.Register2("put_item", d.meter("put_item/2").PutItem)
+	p.Register3("put_item", d.meter("put_item/3").PutItemWithOptions)
+	p.Register3("update_item", d.meter("update_item/3").UpdateItem)
+	p.Register4("update_item", d.meter("update_item/4").UpdateItemReturning)
+	p.Register5("update_item", d.meter("update_item/5").UpdateItemWithOptions)
+	p.Register2("delete_item", d.meter("delete_item/2").DeleteItem)
+	p.Register3("delete_item", d.meter("delete_item/3").DeleteItemWithOptions)
+	p.Register3("batch_get_item", d.meter("batch_get_item/3").BatchGetItem)
+	p.Register4("batch_get_item", d.meter("batch_get_item/4").BatchGetItemWithOptions)
+	p.Register2("batch_write", d.meter("batch_write/2").BatchWrite)
+	p.Register3("batch_write", d.meter("batch_write/3").BatchWriteWithOptions)
+	p.Register1("transact", d.meter("transact/1").Transact)
+	p.Register2("transact", d.meter("transact/2").TransactWithOptions)
+	p.Register2("transact_get", d.meter("transact_get/2").TransactGet)
+	p.Register3("transact_get", d.meter("transact_get/3").TransactGetWithOptions)
+	p.Register3("execute_statement", d.meter("execute_statement/3").ExecuteStatement)
+	p.Register4("execute_statement", d.meter("execute_statement/4").ExecuteStatementWithOptions)
+	p.Register2("stream_record", d.meter("stream_record/2").StreamRecord)
+	p.Register3("stream_record", d.meter("stream_record/3").StreamRecordWithOptions)
+	p.Register2("export_table", d.meter("export_table/2").ExportTableFile)
+	p.Register3("export_table", d.meter("export_table/3").ExportTableFileWithOptions)
+	p.Register2("import_table", d.meter("import_table/2").ImportTableFile)
+	p.Register3("import_table", d.meter("import_table/3").ImportTableFileWithOptions)
+	p.Register2("dynamo_schema", d.meter("dynamo_schema/2").DynamoSchema)
+	p.Register3("$dynamo_table", d.defineTable)
+	p.Register3("dynamo_fact", d.meter("dynamo_fact/3").DynamoFact)
+	p.Register1("dynamo_assert", d.meter("dynamo_assert/1").DynamoAssert)
+	p.Register1("dynamo_retract", d.meter("dynamo_retract/1").DynamoRetract)
+	p.Register1("dynamo_stats", d.DynamoStats)
 	p.Register2("attribute_value", d.AttributeValue)
 }
 
@@ -41,168 +155,1560 @@ func (d Dynamo) Bootstrap(p *prolog.Interpreter) {
 	}
 }
 
+// ListTables (list_tables/1) succeeds for every table name.
+// Use Conn:Table to list the tables of another connection (see WithConnection).
+//
+//	list_tables(-Table).
 func (d Dynamo) ListTables(name engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
-	tables, err := d.db.ListTables().All()
+	return d.ListTablesWithOptions(engine.Atom("[]"), name, k, env)
+}
+
+// ListTablesWithOptions (list_tables/2) is like list_tables/1 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if listing every table takes longer than Ms milliseconds.
+//
+//	list_tables(+Options, -Table).
+func (d Dynamo) ListTablesWithOptions(options, name engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, name, ex := d.qualified(name, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	timeout, err := timeoutOption(options, "table_option", env)
 	if err != nil {
 		return engine.Error(err)
 	}
-	ks := make([]func(context.Context) *engine.Promise, 0, len(tables))
-	for _, t := range tables {
-		table := engine.Atom(t)
-		ks = append(ks, func(_ context.Context) *engine.Promise {
-			return engine.Unify(name, table, k, env)
-		})
-	}
-	return engine.Delay(ks...)
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		tables, err := d.db.ListTables().AllWithContext(ctx)
+		if err != nil {
+			return throw(err, "", env)
+		}
+		ks := make([]func(context.Context) *engine.Promise, 0, len(tables))
+		for _, t := range tables {
+			table := engine.Atom(t)
+			ks = append(ks, func(_ context.Context) *engine.Promise {
+				return engine.Unify(name, table, k, env)
+			})
+		}
+		return engine.Delay(ks...)
+	})
 }
 
-func (d Dynamo) Scan(table, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
-	from, ex := tableName(env.Resolve(table))
+// DescribeTable (describe_table/2) unifies Info with a key-value list describing Table:
+// name, status, key_schema, attributes, global_indexes, local_indexes, item_count, size, billing_mode, and throughput.
+//
+//	describe_table(+Table, -Info).
+func (d Dynamo) DescribeTable(table, info engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.DescribeTableWithOptions(table, engine.Atom("[]"), info, k, env)
+}
+
+// DescribeTableWithOptions (describe_table/3) is like describe_table/2 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if the request takes longer than Ms milliseconds.
+//
+//	describe_table(+Table, +Options, -Info).
+func (d Dynamo) DescribeTableWithOptions(table, options, info engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, name, ex := d.resolve(table, env)
 	if ex != nil {
 		return engine.Error(ex)
 	}
+	timeout, err := timeoutOption(options, "table_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
 
-	iter := d.db.Table(from).Scan().Iter()
-	return engine.Delay(func(context.Context) *engine.Promise {
-		return engine.Repeat(func(ctx context.Context) *engine.Promise {
-			var result map[string]*dynamodb.AttributeValue
-			if !iter.NextWithContext(ctx, &result) {
-				// done
-				if err := iter.Err(); err != nil {
-					return engine.Error(err)
-				}
-				return engine.Bool(true)
-			}
-			value := item2prolog(result)
-			return engine.Unify(item, value, k, env)
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		out, err := d.db.Client().DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(name),
 		})
+		if err != nil {
+			return throw(err, name, env)
+		}
+		return engine.Unify(info, desc2prolog(out.Table), k, env)
 	})
 }
 
-func (d Dynamo) GetItem(table, keys, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
-	from, ex := tableName(env.Resolve(table))
+// CreateTable (create_table/2) creates Table. Spec is a key-value list in the same format as describe_table/2,
+// of which key_schema, attributes, global_indexes, local_indexes, throughput, and stream are used.
+// Without throughput, the table uses on-demand billing.
+// stream-View enables the table's stream, where View is keys_only, new_image, old_image, or new_and_old_images.
+//
+//	create_table(+Table, +Spec).
+func (d Dynamo) CreateTable(table, spec engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.CreateTableWithOptions(table, spec, engine.Atom("[]"), k, env)
+}
+
+// CreateTableWithOptions (create_table/3) is like create_table/2 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if the request takes longer than Ms milliseconds.
+//
+//	create_table(+Table, +Spec, +Options).
+func (d Dynamo) CreateTableWithOptions(table, spec, options engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, name, ex := d.resolve(table, env)
 	if ex != nil {
 		return engine.Error(ex)
 	}
 
-	pk, rk, err := splitkeys(env.Resolve(keys), env)
+	input, err := prolog2create(name, spec, env)
+	if err != nil {
+		return throw(err, name, env)
+	}
+	timeout, err := timeoutOption(options, "table_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		if _, err := d.db.Client().CreateTableWithContext(ctx, input); err != nil {
+			return throw(err, name, env)
+		}
+		d.forget(name)
+		return k(env)
+	})
+}
+
+// DeleteTable (delete_table/1) deletes Table.
+//
+//	delete_table(+Table).
+func (d Dynamo) DeleteTable(table engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.DeleteTableWithOptions(table, engine.Atom("[]"), k, env)
+}
+
+// DeleteTableWithOptions (delete_table/2) is like delete_table/1 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if the request takes longer than Ms milliseconds.
+//
+//	delete_table(+Table, +Options).
+func (d Dynamo) DeleteTableWithOptions(table, options engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, name, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	timeout, err := timeoutOption(options, "table_option", env)
 	if err != nil {
 		return engine.Error(err)
 	}
 
-	pkName, pkValue, err := parsekey(env.Resolve(pk), env)
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		if err := d.db.Table(name).DeleteTable().RunWithContext(ctx); err != nil {
+			return throw(err, name, env)
+		}
+		d.forget(name)
+		return k(env)
+	})
+}
+
+// WaitTable (wait_table/2) blocks until Table's status is Status,
+// one of: active, creating, updating, deleting, or not_exists.
+//
+//	wait_table(+Table, +Status).
+func (d Dynamo) WaitTable(table, status engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.WaitTableWithOptions(table, status, engine.Atom("[]"), k, env)
+}
+
+// WaitTableWithOptions (wait_table/3) is like wait_table/2 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if Table's status isn't Status after Ms milliseconds.
+//
+//	wait_table(+Table, +Status, +Options).
+func (d Dynamo) WaitTableWithOptions(table, status, options engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, name, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+
+	want, err := atomArg(status, env)
+	if err != nil {
+		return throw(err, name, env)
+	}
+	var s dynamo.Status
+	switch want {
+	case "active", "creating", "updating", "deleting":
+		s = dynamo.Status(strings.ToUpper(want))
+	case "not_exists":
+		s = dynamo.NotExistsStatus
+	default:
+		return engine.Error(domainError("table_status", status, env))
+	}
+	timeout, err := timeoutOption(options, "table_option", env)
 	if err != nil {
 		return engine.Error(err)
 	}
-	q := d.db.Table(from).Get(pkName, pkValue)
 
-	if rk != nil {
-		rkName, rkValue, err := parsekey(env.Resolve(rk), env)
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		if err := d.db.Table(name).WaitWithContext(ctx, s); err != nil {
+			return throw(err, name, env)
+		}
+		return k(env)
+	})
+}
+
+func (d Dynamo) Scan(table, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.ScanWithOptions(table, engine.Atom("[]"), item, k, env)
+}
+
+// ScanWithOptions (scan/3) is like scan/2 but takes a list of options:
+// filter(Cond) to only return items matching Cond (see put_item/3 for conditions),
+// project(Attrs) to only return the given list of attributes,
+// limit(N) to return at most N items, page_limit(N) to evaluate at most N items per request,
+// consistent(Bool) for strongly consistent reads, index(Name) to scan a secondary index,
+// segment(N, Total) to scan the Nth segment (starting from 0) of a parallel scan,
+// start(Cursor) to resume from a cursor returned by scan_page/4,
+// skip_expired(true) to skip items whose TTL has expired but that DynamoDB hasn't deleted yet,
+// and timeout(Ms) to throw time_limit_exceeded if the scan takes longer than Ms milliseconds.
+//
+//	scan(+Table, +Options, -Item).
+func (d Dynamo) ScanWithOptions(table, options, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+
+	req, err := scanInput(from, options, env)
+	if err != nil {
+		return throw(err, from, env)
+	}
+
+	deadline := deadlineAfter(req.timeout)
+	if !req.skipExpired {
+		return d.iterate(from, iterUntil(newScanIter(d.db.Client(), req), deadline), item, k, env)
+	}
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadline)
+		defer cancel()
+		attr, err := d.ttlAttr(ctx, from)
 		if err != nil {
-			return engine.Error(err)
+			return throw(err, from, env)
 		}
-		q.Range(rkName, dynamo.Equal, rkValue)
+		iter := &unexpiredIter{attr: attr, limit: req.limit}
+		req.limit = 0
+		iter.Iter = newScanIter(d.db.Client(), req)
+		return d.iterate(from, iterUntil(iter, deadline), item, k, env)
+	})
+}
+
+// ScanPage (scan_page/4) scans a single page of Table, unifying Items with the list of items in the page
+// and Cursor with an atom that can be passed back with the start(Cursor) option to get the next page.
+// After the last page, Cursor is end.
+// It takes the same options as scan/3, where limit(N) is the maximum number of items in the page.
+// With skip_expired(true), expired items are removed from the page, so it can have fewer items.
+//
+//	scan_page(+Table, +Options, -Items, -Cursor).
+func (d Dynamo) ScanPage(table, options, items, cursor engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
 	}
 
-	return engine.Delay(func(context.Context) *engine.Promise {
-		var result map[string]*dynamodb.AttributeValue
-		err := q.One(&result)
+	req, err := scanInput(from, options, env)
+	if err != nil {
+		return throw(err, from, env)
+	}
+	if req.limit > 0 && (req.input.Limit == nil || *req.input.Limit > req.limit) {
+		req.input.Limit = aws.Int64(req.limit)
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		if req.done {
+			return engine.Unify(engine.Atom("-").Apply(items, cursor), engine.Atom("-").Apply(engine.List(), endCursor), k, env)
+		}
+		ctx, cancel := withDeadline(ctx, deadlineAfter(req.timeout))
+		defer cancel()
+		var attr string
+		if req.skipExpired {
+			var err error
+			if attr, err = d.ttlAttr(ctx, from); err != nil {
+				return throw(err, from, env)
+			}
+		}
+		out, err := d.db.Client().ScanWithContext(ctx, req.input)
 		if err != nil {
-			return engine.Error(err)
+			return throw(err, from, env)
+		}
+		now := time.Now()
+		list := make([]engine.Term, 0, len(out.Items))
+		for _, result := range out.Items {
+			if expired(result, attr, now) {
+				continue
+			}
+			it, err := d.item2prolog(result)
+			if err != nil {
+				return throw(err, from, env)
+			}
+			list = append(list, it)
+		}
+		next, err := encodeCursor(out.LastEvaluatedKey)
+		if err != nil {
+			return throw(err, from, env)
+		}
+		return engine.Unify(engine.Atom("-").Apply(items, cursor), engine.Atom("-").Apply(engine.List(list...), next), k, env)
+	})
+}
+
+// GetItem (get_item/3) gets the item with the given key, failing if it doesn't exist.
+// Keys with plain values, such as ['UserID'-42, 'Time'-'2001'] or key(42, '2001'),
+// are converted using the table's key schema.
+// If d has a cache (see WithCache), the item might come from it.
+//
+//	get_item(+Table, +Key, -Item).
+func (d Dynamo) GetItem(table, keys, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.GetItemWithOptions(table, keys, engine.Atom("[]"), item, k, env)
+}
+
+// GetItemWithOptions (get_item/4) is like get_item/3 but takes a list of options:
+// consistent(true) does a strongly consistent read, skipping the cache, and
+// timeout(Ms) throws time_limit_exceeded if the read takes longer than Ms milliseconds.
+//
+//	get_item(+Table, +Key, +Options, -Item).
+func (d Dynamo) GetItemWithOptions(table, keys, options, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+
+	var consistent bool
+	var timeout time.Duration
+	err := eachOption(options, env, func(opt engine.Compound) error {
+		var err error
+		switch {
+		case opt.Functor() == "consistent" && opt.Arity() == 1:
+			consistent, err = boolArg(opt.Arg(0), env)
+		case opt.Functor() == "timeout" && opt.Arity() == 1:
+			timeout, err = timeoutArg(opt.Arg(0), env)
+		default:
+			err = domainError("get_option", opt, env)
+		}
+		return err
+	})
+	if err != nil {
+		return throw(err, from, env)
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		key, err := d.itemKey(ctx, from, keys, env)
+		if err != nil {
+			return throw(err, from, env)
+		}
+
+		result, err := d.get(ctx, from, key, consistent)
+		if err != nil {
+			return throw(err, from, env)
+		}
+		if result == nil {
+			return engine.Bool(false)
+		}
+
+		it, err := d.item2prolog(result)
+		if err != nil {
+			return throw(err, from, env)
 		}
-		it := item2prolog(result)
 		return engine.Unify(it, item, k, env)
 	})
 }
 
+// Query (query/3) succeeds for every item in the partition given by key.
+// The sort key, if given, can use the comparison operators (=, <, =<, >, >=)
+// or between(Lo, Hi) and begins_with(Prefix).
+//
+//	query(+Table, +KeyCond, -Item).
 func (d Dynamo) Query(table, keys, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
-	from, ex := tableName(env.Resolve(table))
+	return d.QueryWithOptions(table, keys, engine.Atom("[]"), item, k, env)
+}
+
+// QueryWithOptions (query/4) is like query/3 but takes a list of options:
+// index(Name) to query a secondary index, order(asc) or order(desc) to sort by the sort key,
+// limit(N) to return at most N items, consistent(Bool) for strongly consistent reads,
+// skip_expired(true) to skip items whose TTL has expired but that DynamoDB hasn't deleted yet,
+// and timeout(Ms) to throw time_limit_exceeded if the query takes longer than Ms milliseconds.
+//
+//	query(+Table, +KeyCond, +Options, -Item).
+func (d Dynamo) QueryWithOptions(table, keys, options, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
 	if ex != nil {
 		return engine.Error(ex)
 	}
 
-	pk, rk, err := splitkeys(env.Resolve(keys), env)
+	opts, err := parseQueryOptions(options, env)
 	if err != nil {
 		return engine.Error(err)
 	}
+	return d.query(from, keys, opts, false, item, k, env)
+}
+
+// IndexQuery (index_query/4) is like query/3 but queries the secondary index Index of Table.
+// KeyCond must use the index's key schema, otherwise it throws error(domain_error(key_schema(Schema), KeyCond), _).
+// If Item is a list of Attr-Value pairs (or a partial list), every Attr must be projected into the index,
+// otherwise it throws error(domain_error(index_projection(Index, Attrs), Attr), _).
+//
+//	index_query(+Table, +Index, +KeyCond, -Item).
+func (d Dynamo) IndexQuery(table, index, keys, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.IndexQueryWithOptions(table, index, keys, engine.Atom("[]"), item, k, env)
+}
 
-	pkName, pkValue, err := parsekey(env.Resolve(pk), env)
+// IndexQueryWithOptions (index_query/5) is like index_query/4 but takes the same options as query/4.
+// An index(Name) option must name Index.
+//
+//	index_query(+Table, +Index, +KeyCond, +Options, -Item).
+func (d Dynamo) IndexQueryWithOptions(table, index, keys, options, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	name, err := atomArg(index, env)
+	if err != nil {
+		return throw(err, from, env)
+	}
+	opts, err := parseQueryOptions(options, env)
 	if err != nil {
 		return engine.Error(err)
 	}
-	q := d.db.Table(from).Get(pkName, pkValue)
+	if opts.index != "" && opts.index != name {
+		return engine.Error(domainError("query_option", engine.Atom("index").Apply(engine.Atom(opts.index)), env))
+	}
+	opts.index = name
+	return d.query(from, keys, opts, true, item, k, env)
+}
 
-	if rk != nil {
-		rkName, rkValue, err := parsekey(env.Resolve(rk), env)
+// query queries table from, or the index in opts, and unifies Item with each item.
+// If projected is true, Item must only use attributes projected into the index.
+func (d Dynamo) query(from string, keys engine.Term, opts queryOptions, projected bool, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	deadline := deadlineAfter(opts.timeout)
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadline)
+		defer cancel()
+		schema, err := d.schema(ctx, from)
 		if err != nil {
-			return engine.Error(err)
+			return throw(err, from, env)
 		}
-		q.Range(rkName, dynamo.Equal, rkValue)
-	}
-
-	return engine.Delay(func(context.Context) *engine.Promise {
-		var result map[string]*dynamodb.AttributeValue
-		err := q.One(&result)
+		ks := schema.keySchema
+		if opts.index != "" {
+			idx, ok := schema.indexes[opts.index]
+			if !ok {
+				return engine.Error(existenceError("index", engine.Atom(opts.index), env))
+			}
+			ks = idx.keySchema
+		}
+		if err := schema.checkKeyCond(ks, keys, env); err != nil {
+			return throw(err, from, env)
+		}
+		if projected {
+			if err := schema.checkProjection(opts.index, item, env); err != nil {
+				return throw(err, from, env)
+			}
+		}
+		q, err := keyQuery(d.db.Table(from), schema, keys, env)
 		if err != nil {
-			return engine.Error(err)
+			return throw(err, from, env)
 		}
-		it := item2prolog(result)
-		return engine.Unify(it, item, k, env)
+		opts.apply(q)
+		var iter dynamo.Iter = q.Iter()
+		if opts.skipExpired {
+			attr, err := d.ttlAttr(ctx, from)
+			if err != nil {
+				return throw(err, from, env)
+			}
+			iter = &unexpiredIter{Iter: iter, attr: attr, limit: opts.limit}
+		}
+		return d.iterate(from, iterUntil(iter, deadline), item, k, env)
+	})
+}
+
+// queryOptions are the options of query/4 and index_query/5.
+type queryOptions struct {
+	index       string
+	order       *dynamo.Order
+	limit       int64
+	consistent  bool
+	skipExpired bool
+	timeout     time.Duration
+}
+
+// parseQueryOptions parses the list of query/4 options.
+func parseQueryOptions(options engine.Term, env *engine.Env) (queryOptions, error) {
+	var qo queryOptions
+	err := eachOption(options, env, func(opt engine.Compound) error {
+		switch {
+		case opt.Functor() == "index" && opt.Arity() == 1:
+			index, err := atomArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			qo.index = index
+		case opt.Functor() == "order" && opt.Arity() == 1:
+			order, err := atomArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			var o dynamo.Order
+			switch order {
+			case "asc":
+				o = dynamo.Ascending
+			case "desc":
+				o = dynamo.Descending
+			default:
+				return domainError("order", opt.Arg(0), env)
+			}
+			qo.order = &o
+		case opt.Functor() == "limit" && opt.Arity() == 1:
+			n, err := intArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			qo.limit = n
+		case opt.Functor() == "consistent" && opt.Arity() == 1:
+			on, err := boolArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			qo.consistent = on
+		case opt.Functor() == "skip_expired" && opt.Arity() == 1:
+			on, err := boolArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			qo.skipExpired = on
+		case opt.Functor() == "timeout" && opt.Arity() == 1:
+			timeout, err := timeoutArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			qo.timeout = timeout
+		default:
+			return domainError("query_option", opt, env)
+		}
+		return nil
 	})
+	return qo, err
+}
+
+// apply sets the options of q. With skip_expired(true), the limit is left to unexpiredIter.
+func (qo queryOptions) apply(q *dynamo.Query) {
+	if qo.index != "" {
+		q.Index(qo.index)
+	}
+	if qo.order != nil {
+		q.Order(*qo.order)
+	}
+	if qo.limit > 0 && !qo.skipExpired {
+		q.Limit(qo.limit)
+	}
+	q.Consistent(qo.consistent)
 }
 
 func (d Dynamo) PutItem(table, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
-	tbl, ex := tableName(env.Resolve(table))
+	return d.PutItemWithOptions(table, item, engine.Atom("[]"), k, env)
+}
+
+// PutItemWithOptions (put_item/3) is like put_item/2 but takes a list of options:
+// if(Cond) to only write the item if Cond holds, and if_failed(fail) or if_failed(error)
+// to fail (the default) or throw error(dynamodb_error(conditional_check_failed, Msg), _) when it doesn't.
+// ttl(Seconds) or expires_at(Timestamp) sets the table's TTL attribute to Seconds from now or the Unix timestamp Timestamp.
+// If the table doesn't have TTL enabled, they throw error(existence_error(time_to_live, Table), _).
+// timeout(Ms) throws time_limit_exceeded if the write takes longer than Ms milliseconds.
+//
+//	put_item(+Table, +Item, +Options).
+func (d Dynamo) PutItemWithOptions(table, item, options engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, tbl, ex := d.resolve(table, env)
 	if ex != nil {
 		return engine.Error(ex)
 	}
 
 	it, err := list2item(env.Resolve(item), env)
 	if err != nil {
-		return engine.Error(err)
+		return throw(err, tbl, env)
 	}
 
-	return engine.Delay(func(ctx context.Context) *engine.Promise {
-		if err := d.db.Table(tbl).Put(it).RunWithContext(ctx); err != nil {
-			return engine.Error(err)
+	opts, err := parseWriteOptions(options, env)
+	if err != nil {
+		return throw(err, tbl, env)
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(opts.timeout))
+		defer cancel()
+		if opts.expiry != nil {
+			attr, err := d.ttlAttr(ctx, tbl)
+			if err != nil {
+				return throw(err, tbl, env)
+			}
+			if attr == "" {
+				return engine.Error(existenceError("time_to_live", engine.Atom(tbl), env))
+			}
+			it[attr] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(opts.expiresAt(time.Now()), 10))}
 		}
-		return k(env)
+		// the TTL attribute can be declared too
+		if err := d.validate(tbl, it, env); err != nil {
+			return throw(err, tbl, env)
+		}
+		put := d.db.Table(tbl).Put(it)
+		if opts.cond != nil {
+			put.If("?", *opts.cond)
+		}
+		err := put.RunWithContext(ctx)
+		d.cache.invalidate(tbl, it)
+		return opts.result(err, tbl, k, env)
 	})
 }
 
-func (d Dynamo) DeleteItem(table, keys engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
-	from, ex := tableName(env.Resolve(table))
+// UpdateItem (update_item/3) modifies the item with the given key, creating it if it doesn't exist.
+// Actions is a list of set(Path, Value), add(Path, Value), remove(Path), and delete(Path, Set).
+// Paths are attribute names, even reserved words or names with dots, dashes, or spaces.
+//
+//	update_item(+Table, +Key, +Actions).
+func (d Dynamo) UpdateItem(table, keys, actions engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
 	if ex != nil {
 		return engine.Error(ex)
 	}
 
-	pk, rk, err := splitkeys(env.Resolve(keys), env)
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		input, key, err := d.update(ctx, from, keys, actions, env)
+		if err != nil {
+			return throw(err, from, env)
+		}
+		_, err = d.db.Client().UpdateItemWithContext(ctx, input)
+		d.cache.invalidate(from, key.item())
+		if err != nil {
+			return throw(err, from, env)
+		}
+		return k(env)
+	})
+}
+
+// UpdateItemReturning (update_item/4) is like update_item/3 but also unifies the updated item with Item.
+// Use new(Item) or old(Item) to get the item as it appears after or before the update, respectively.
+// A plain Item is the same as new(Item).
+// When old(Item) is given and the item didn't exist before, update_item/4 fails.
+//
+//	update_item(+Table, +Key, +Actions, -Item).
+func (d Dynamo) UpdateItemReturning(table, keys, actions, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.UpdateItemWithOptions(table, keys, actions, engine.Atom("[]"), item, k, env)
+}
+
+// UpdateItemWithOptions (update_item/5) is like update_item/4 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if the update takes longer than Ms milliseconds.
+//
+//	update_item(+Table, +Key, +Actions, +Options, -Item).
+func (d Dynamo) UpdateItemWithOptions(table, keys, actions, options, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	timeout, err := timeoutOption(options, "update_option", env)
 	if err != nil {
 		return engine.Error(err)
 	}
 
-	pkName, pkValue, err := parsekey(env.Resolve(pk), env)
-	if err != nil {
-		return engine.Error(err)
+	old := false
+	if cmp, ok := env.Resolve(item).(engine.Compound); ok && cmp.Arity() == 1 {
+		switch cmp.Functor() {
+		case "new":
+			item = cmp.Arg(0)
+		case "old":
+			item = cmp.Arg(0)
+			old = true
+		}
 	}
-	q := d.db.Table(from).Delete(pkName, pkValue)
 
-	if rk != nil {
-		rkName, rkValue, err := parsekey(env.Resolve(rk), env)
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		input, key, err := d.update(ctx, from, keys, actions, env)
 		if err != nil {
-			return engine.Error(err)
+			return throw(err, from, env)
+		}
+		input.ReturnValues = aws.String(dynamodb.ReturnValueAllNew)
+		if old {
+			input.ReturnValues = aws.String(dynamodb.ReturnValueAllOld)
+		}
+		out, err := d.db.Client().UpdateItemWithContext(ctx, input)
+		d.cache.invalidate(from, key.item())
+		if err != nil {
+			return throw(err, from, env)
 		}
-		q.Range(rkName, rkValue)
+		if len(out.Attributes) == 0 {
+			return engine.Bool(false)
+		}
+		it, err := d.item2prolog(out.Attributes)
+		if err != nil {
+			return throw(err, from, env)
+		}
+		return engine.Unify(item, it, k, env)
+	})
+}
+
+// update returns the request that applies the list of actions to the item of table from with the given key.
+func (d Dynamo) update(ctx context.Context, from string, keys, actions engine.Term, env *engine.Env) (*dynamodb.UpdateItemInput, itemKey, error) {
+	key, err := d.itemKey(ctx, from, keys, env)
+	if err != nil {
+		return nil, key, err
+	}
+	var c compiler
+	expr, err := c.update(actions, env)
+	if err != nil {
+		return nil, key, err
+	}
+	if err := d.validateUpdate(from, actions, env); err != nil {
+		return nil, key, err
 	}
+	return &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(from),
+		Key:                       key.item(),
+		UpdateExpression:          aws.String(expr),
+		ExpressionAttributeNames:  c.names,
+		ExpressionAttributeValues: c.values,
+	}, key, nil
+}
 
-	return engine.Delay(func(ctx context.Context) *engine.Promise {
-		if err := q.RunWithContext(ctx); err != nil {
-			return engine.Error(err)
+func (d Dynamo) DeleteItem(table, keys engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.DeleteItemWithOptions(table, keys, engine.Atom("[]"), k, env)
+}
+
+// DeleteItemWithOptions (delete_item/3) is like delete_item/2 but takes a list of options.
+// See put_item/3 for the available options, except ttl(Seconds) and expires_at(Timestamp).
+//
+//	delete_item(+Table, +Key, +Options).
+func (d Dynamo) DeleteItemWithOptions(table, keys, options engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+
+	opts, err := parseWriteOptions(options, env)
+	if err != nil {
+		return throw(err, from, env)
+	}
+	if opts.expiry != nil {
+		return engine.Error(domainError("write_option", opts.expiry, env))
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(opts.timeout))
+		defer cancel()
+		key, err := d.itemKey(ctx, from, keys, env)
+		if err != nil {
+			return throw(err, from, env)
 		}
-		return k(env)
+		q := d.db.Table(from).Delete(key.pk, key.pv)
+		if key.sk != "" {
+			q.Range(key.sk, key.sv)
+		}
+		if opts.cond != nil {
+			q.If("?", *opts.cond)
+		}
+		err = q.RunWithContext(ctx)
+		d.cache.invalidate(from, key.item())
+		return opts.result(err, from, k, env)
 	})
 }
 
+// Transact (transact/1) runs the list of write operations as a single transaction.
+// Operations are put(Table, Item), update(Table, Key, Actions), delete(Table, Key), and check(Table, Key, Cond).
+// If the transaction is canceled, it throws error(dynamodb_error(transaction_canceled, Reasons), _)
+// where Reasons is a list of reason(N, Op, Code, Message) for every operation that caused the cancellation,
+// N is the position of Op in the list starting from 1, and Code is an atom such as conditional_check_failed.
+// Every table must use the same connection, otherwise it throws error(domain_error(same_connection, Op), _).
+//
+//	transact(+Ops).
+func (d Dynamo) Transact(ops engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.TransactWithOptions(ops, engine.Atom("[]"), k, env)
+}
+
+// TransactWithOptions (transact/2) is like transact/1 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if the transaction takes longer than Ms milliseconds.
+//
+//	transact(+Ops, +Options).
+func (d Dynamo) TransactWithOptions(ops, options engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	timeout, err := timeoutOption(options, "transact_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		conn := d
+		var tx dynamodb.TransactWriteItemsInput
+		var list []engine.Term
+		var writes []cachedWrite
+		iter := engine.ListIterator{List: env.Resolve(ops), Env: env}
+		for iter.Next() {
+			c, op, from, err := d.txTable(iter.Current(), env)
+			if err != nil {
+				return throw(err, "", env)
+			}
+			if list == nil {
+				conn = c
+			} else if !sameConn(c, conn) {
+				return engine.Error(domainError("same_connection", op, env))
+			}
+			if err := c.txOp(ctx, &tx, op, from, &writes, env); err != nil {
+				return throw(err, "", env)
+			}
+			list = append(list, op)
+		}
+		if err := iter.Err(); err != nil {
+			return throw(err, "", env)
+		}
+		if len(tx.TransactItems) == 0 {
+			return throw(dynamo.ErrNoInput, "", env)
+		}
+
+		_, err := conn.db.Client().TransactWriteItemsWithContext(ctx, &tx)
+		conn.cache.written(writes)
+		if err != nil {
+			if reasons, ok := cancellationReasons(err, list); ok {
+				return engine.Error(engine.NewException(engine.Atom("error").Apply(
+					engine.Atom("dynamodb_error").Apply(engine.Atom("transaction_canceled"), reasons),
+					engine.NewVariable(),
+				), env))
+			}
+			return throw(err, "", env)
+		}
+		return k(env)
+	})
+}
+
+// txTable returns the transaction operation t with the connection and name of its table.
+func (d Dynamo) txTable(t engine.Term, env *engine.Env) (Dynamo, engine.Compound, string, error) {
+	var op engine.Compound
+	switch t := env.Resolve(t).(type) {
+	case engine.Variable:
+		return d, nil, "", engine.InstantiationError(env)
+	case engine.Compound:
+		op = t
+	default:
+		return d, nil, "", engine.TypeError(engine.ValidTypeCompound, t, env)
+	}
+
+	if op.Arity() < 2 {
+		return d, nil, "", domainError("transact_op", op, env)
+	}
+	conn, from, err := d.resolve(op.Arg(0), env)
+	return conn, op, from, err
+}
+
+// txOp adds the operation op on the table from to tx, appending the items it writes to writes.
+func (d Dynamo) txOp(ctx context.Context, tx *dynamodb.TransactWriteItemsInput, op engine.Compound, from string, writes *[]cachedWrite, env *engine.Env) error {
+	var item dynamodb.TransactWriteItem
+	switch {
+	case op.Functor() == "update" && op.Arity() == 3:
+		u, key, err := d.update(ctx, from, op.Arg(1), op.Arg(2), env)
+		if err != nil {
+			return err
+		}
+		item.Update = &dynamodb.Update{
+			TableName:                 u.TableName,
+			Key:                       u.Key,
+			UpdateExpression:          u.UpdateExpression,
+			ExpressionAttributeNames:  u.ExpressionAttributeNames,
+			ExpressionAttributeValues: u.ExpressionAttributeValues,
+		}
+		*writes = append(*writes, cachedWrite{table: from, item: key.item()})
+	case op.Functor() == "put" && op.Arity() == 2:
+		it, err := list2item(env.Resolve(op.Arg(1)), env)
+		if err != nil {
+			return err
+		}
+		if err := d.validate(from, it, env); err != nil {
+			return err
+		}
+		item.Put = &dynamodb.Put{TableName: aws.String(from), Item: it}
+		*writes = append(*writes, cachedWrite{table: from, item: it})
+	case op.Functor() == "delete" && op.Arity() == 2:
+		key, err := d.itemKey(ctx, from, op.Arg(1), env)
+		if err != nil {
+			return err
+		}
+		item.Delete = &dynamodb.Delete{TableName: aws.String(from), Key: key.item()}
+		*writes = append(*writes, cachedWrite{table: from, item: key.item()})
+	case op.Functor() == "check" && op.Arity() == 3:
+		key, err := d.itemKey(ctx, from, op.Arg(1), env)
+		if err != nil {
+			return err
+		}
+		cond, err := condition(op.Arg(2), env)
+		if err != nil {
+			return err
+		}
+		item.ConditionCheck = &dynamodb.ConditionCheck{
+			TableName:                 aws.String(from),
+			Key:                       key.item(),
+			ConditionExpression:       aws.String(cond.Expression),
+			ExpressionAttributeNames:  cond.AttributeNames,
+			ExpressionAttributeValues: cond.AttributeValues,
+		}
+	default:
+		return domainError("transact_op", op, env)
+	}
+	tx.TransactItems = append(tx.TransactItems, &item)
+	return nil
+}
+
+// TransactGet (transact_get/2) gets the items for the list of get(Table, Key) in a single transaction.
+// Items is a list of items in the same order, where missing items are [].
+// Every table must use the same connection, like transact/1.
+//
+//	transact_get(+Gets, -Items).
+func (d Dynamo) TransactGet(gets, items engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.TransactGetWithOptions(gets, engine.Atom("[]"), items, k, env)
+}
+
+// TransactGetWithOptions (transact_get/3) is like transact_get/2 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if the transaction takes longer than Ms milliseconds.
+//
+//	transact_get(+Gets, +Options, -Items).
+func (d Dynamo) TransactGetWithOptions(gets, options, items engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	timeout, err := timeoutOption(options, "transact_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		conn := d
+		var tx *dynamo.GetTx
+		var results []*map[string]*dynamodb.AttributeValue
+		iter := engine.ListIterator{List: env.Resolve(gets), Env: env}
+		for iter.Next() {
+			get, ok := env.Resolve(iter.Current()).(engine.Compound)
+			if !ok || get.Functor() != "get" || get.Arity() != 2 {
+				return engine.Error(domainError("transact_get", iter.Current(), env))
+			}
+			c, from, err := d.resolve(get.Arg(0), env)
+			if err != nil {
+				return throw(err, "", env)
+			}
+			if tx == nil {
+				conn, tx = c, c.db.GetTx()
+			} else if !sameConn(c, conn) {
+				return engine.Error(domainError("same_connection", get, env))
+			}
+			key, err := c.itemKey(ctx, from, get.Arg(1), env)
+			if err != nil {
+				return throw(err, "", env)
+			}
+			q := c.db.Table(from).Get(key.pk, key.pv)
+			if key.sk != "" {
+				q.Range(key.sk, dynamo.Equal, key.sv)
+			}
+			result := new(map[string]*dynamodb.AttributeValue)
+			tx.GetOne(q, result)
+			results = append(results, result)
+		}
+		if err := iter.Err(); err != nil {
+			return throw(err, "", env)
+		}
+		if tx == nil {
+			tx = d.db.GetTx()
+		}
+
+		if err := tx.RunWithContext(ctx); err != nil && err != dynamo.ErrNotFound {
+			return throw(err, "", env)
+		}
+		list := make([]engine.Term, 0, len(results))
+		for _, result := range results {
+			if *result == nil {
+				list = append(list, engine.Atom("[]"))
+				continue
+			}
+			it, err := conn.item2prolog(*result)
+			if err != nil {
+				return throw(err, "", env)
+			}
+			list = append(list, it)
+		}
+		return engine.Unify(items, engine.List(list...), k, env)
+	})
+}
+
+// BatchGetItem (batch_get_item/3) gets the items for the list of Keys from Table.
+// Requests are split into chunks of 100 and unprocessed keys are retried with exponential backoff.
+// Items is a list of items in the same order as Keys, where missing items are [].
+// Every key must use the same attribute names. Keys that appear more than once, such as n(1) and n('1.0'), are only requested once.
+//
+//	batch_get_item(+Table, +Keys, -Items).
+func (d Dynamo) BatchGetItem(table, keys, items engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.BatchGetItemWithOptions(table, keys, engine.Atom("[]"), items, k, env)
+}
+
+// BatchGetItemWithOptions (batch_get_item/4) is like batch_get_item/3 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if getting every item, retries included, takes longer than Ms milliseconds.
+//
+//	batch_get_item(+Table, +Keys, +Options, -Items).
+func (d Dynamo) BatchGetItemWithOptions(table, keys, options, items engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	timeout, err := timeoutOption(options, "batch_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		var pk, sk string
+		var keyed []dynamo.Keyed
+		var order []string
+		// DynamoDB rejects duplicate keys, so each key is only sent once
+		seen := make(map[string]bool)
+		iter := engine.ListIterator{List: env.Resolve(keys), Env: env}
+		for iter.Next() {
+			key, err := d.itemKey(ctx, from, iter.Current(), env)
+			if err != nil {
+				return throw(err, from, env)
+			}
+			// itemKey checks every key against the key schema, so they all have the same attributes
+			pk, sk = key.pk, key.sk
+			order = append(order, key.String())
+			if seen[key.String()] {
+				continue
+			}
+			seen[key.String()] = true
+			keyed = append(keyed, key.keyed())
+		}
+		if err := iter.Err(); err != nil {
+			return throw(err, from, env)
+		}
+
+		found := make(map[string]engine.Term, len(keyed))
+		if len(keyed) > 0 {
+			batch := d.db.Table(from).Batch(pk, sk)
+			if sk == "" {
+				batch = d.db.Table(from).Batch(pk)
+			}
+			iter := batch.Get(keyed...).Iter()
+			var result map[string]*dynamodb.AttributeValue
+			for iter.NextWithContext(ctx, &result) {
+				key := itemKey{pk: pk, pv: result[pk], sk: sk, sv: result[sk]}
+				it, err := d.item2prolog(result)
+				if err != nil {
+					return throw(err, from, env)
+				}
+				found[key.String()] = it
+			}
+			if err := iter.Err(); err != nil && err != dynamo.ErrNotFound {
+				return throw(err, from, env)
+			}
+		}
+
+		list := make([]engine.Term, 0, len(order))
+		for _, key := range order {
+			item, ok := found[key]
+			if !ok {
+				item = engine.Atom("[]")
+			}
+			list = append(list, item)
+		}
+		return engine.Unify(items, engine.List(list...), k, env)
+	})
+}
+
+// BatchWrite (batch_write/2) runs the list of put(Item) and delete(Key) operations against Table.
+// Requests are split into chunks of 25 and unprocessed items are retried with exponential backoff.
+// Every key must use the same attribute names.
+//
+//	batch_write(+Table, +Ops).
+func (d Dynamo) BatchWrite(table, ops engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.BatchWriteWithOptions(table, ops, engine.Atom("[]"), k, env)
+}
+
+// BatchWriteWithOptions (batch_write/3) is like batch_write/2 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if writing every item, retries included, takes longer than Ms milliseconds.
+//
+//	batch_write(+Table, +Ops, +Options).
+func (d Dynamo) BatchWriteWithOptions(table, ops, options engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	timeout, err := timeoutOption(options, "batch_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		var pk, sk string
+		var puts []interface{}
+		var dels []dynamo.Keyed
+		var writes []cachedWrite
+		iter := engine.ListIterator{List: env.Resolve(ops), Env: env}
+		for iter.Next() {
+			op, ok := env.Resolve(iter.Current()).(engine.Compound)
+			if !ok || op.Arity() != 1 {
+				return engine.Error(domainError("batch_write_op", iter.Current(), env))
+			}
+			switch op.Functor() {
+			case "put":
+				item, err := list2item(env.Resolve(op.Arg(0)), env)
+				if err != nil {
+					return throw(err, from, env)
+				}
+				if err := d.validate(from, item, env); err != nil {
+					return throw(err, from, env)
+				}
+				puts = append(puts, item)
+				writes = append(writes, cachedWrite{table: from, item: item})
+			case "delete":
+				key, err := d.itemKey(ctx, from, op.Arg(0), env)
+				if err != nil {
+					return throw(err, from, env)
+				}
+				pk, sk = key.pk, key.sk
+				dels = append(dels, key.keyed())
+				writes = append(writes, cachedWrite{table: from, item: key.item()})
+			default:
+				return engine.Error(domainError("batch_write_op", op, env))
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return throw(err, from, env)
+		}
+
+		if len(puts)+len(dels) == 0 {
+			return k(env)
+		}
+		batch := d.db.Table(from).Batch(pk, sk)
+		if sk == "" {
+			batch = d.db.Table(from).Batch(pk)
+		}
+		_, err := batch.Write().Put(puts...).Delete(dels...).RunWithContext(ctx)
+		d.cache.written(writes)
+		if err != nil {
+			return throw(err, from, env)
+		}
+		return k(env)
+	})
+}
+
+// ExecuteStatement (execute_statement/3) runs a PartiQL statement, where Params are the values of its ? placeholders,
+// in the same format as item values.
+// It succeeds for every item returned by the statement, fetching more pages on backtracking.
+// Statements other than SELECT that don't return items, such as INSERT, succeed once with Item = [].
+// Use Conn:Statement to run it on another connection (see WithConnection).
+//
+//	execute_statement(+Statement, +Params, -Item).
+func (d Dynamo) ExecuteStatement(statement, params, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.ExecuteStatementWithOptions(statement, params, engine.Atom("[]"), item, k, env)
+}
+
+// ExecuteStatementWithOptions (execute_statement/4) is like execute_statement/3 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if fetching the items takes longer than Ms milliseconds.
+//
+//	execute_statement(+Statement, +Params, +Options, -Item).
+func (d Dynamo) ExecuteStatementWithOptions(statement, params, options, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, statement, err := d.qualified(statement, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	stmt, err := atomArg(statement, env)
+	if err != nil {
+		return throw(err, "", env)
+	}
+	input := &dynamodb.ExecuteStatementInput{
+		Statement: aws.String(stmt),
+	}
+	iter := engine.ListIterator{List: env.Resolve(params), Env: env}
+	for iter.Next() {
+		av, err := prolog2av(iter.Current(), env)
+		if err != nil {
+			return throw(err, "", env)
+		}
+		input.Parameters = append(input.Parameters, av)
+	}
+	if err := iter.Err(); err != nil {
+		return throw(err, "", env)
+	}
+	selecting := strings.HasPrefix(strings.ToUpper(strings.TrimSpace(stmt)), "SELECT")
+	timeout, err := timeoutOption(options, "statement_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	deadline := deadlineAfter(timeout)
+
+	var items []map[string]*dynamodb.AttributeValue
+	var done, found bool
+	var next func(context.Context) *engine.Promise
+	next = func(ctx context.Context) *engine.Promise {
+		for len(items) == 0 {
+			if done {
+				if !found && !selecting {
+					found = true
+					return engine.Unify(item, engine.List(), k, env)
+				}
+				return engine.Bool(false)
+			}
+			ctx, cancel := withDeadline(ctx, deadline)
+			out, err := d.db.Client().ExecuteStatementWithContext(ctx, input)
+			cancel()
+			if err != nil {
+				return throw(err, "", env)
+			}
+			items = out.Items
+			input.NextToken = out.NextToken
+			done = out.NextToken == nil
+		}
+		found = true
+		value, err := d.item2prolog(items[0])
+		if err != nil {
+			return throw(err, "", env)
+		}
+		items = items[1:]
+		return d.delay(func(context.Context) *engine.Promise {
+			return engine.Unify(item, value, k, env)
+		}, next)
+	}
+	return d.delay(next)
+}
+
+// StreamRecord (stream_record/2) succeeds for every change in Table's stream, from oldest to newest.
+// Event is insert(NewItem), modify(OldItem, NewItem), or remove(OldKeys).
+// Images that aren't in the stream, depending on its view type, are replaced by the item's keys.
+// It reads the records currently in the stream and then stops, so call it again to get newer changes.
+// Requires a DynamoDB Streams client (see WithStreams).
+//
+//	stream_record(+Table, -Event).
+func (d Dynamo) StreamRecord(table, event engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.StreamRecordWithOptions(table, engine.Atom("[]"), event, k, env)
+}
+
+// StreamRecordWithOptions (stream_record/3) is like stream_record/2 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if reading the stream takes longer than Ms milliseconds.
+//
+//	stream_record(+Table, +Options, -Event).
+func (d Dynamo) StreamRecordWithOptions(table, options, event engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	if d.streams == nil {
+		return engine.Error(engine.SystemError(errors.New("dynamodb: stream_record/2 requires a DynamoDB Streams client, see WithStreams")))
+	}
+	timeout, err := timeoutOption(options, "stream_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	deadline := deadlineAfter(timeout)
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadline)
+		defer cancel()
+		out, err := d.db.Client().DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(from),
+		})
+		if err != nil {
+			return throw(err, from, env)
+		}
+		arn := aws.StringValue(out.Table.LatestStreamArn)
+		if spec := out.Table.StreamSpecification; arn == "" || spec == nil || !aws.BoolValue(spec.StreamEnabled) {
+			return engine.Error(existenceError("stream", engine.Atom(from), env))
+		}
+		r, err := newStreamReader(ctx, d.streams, arn)
+		if err != nil {
+			return throw(err, "", env)
+		}
+
+		var next func(context.Context) *engine.Promise
+		next = func(ctx context.Context) *engine.Promise {
+			ctx, cancel := withDeadline(ctx, deadline)
+			defer cancel()
+			rec, err := r.next(ctx)
+			if err != nil {
+				return throw(err, "", env)
+			}
+			if rec == nil {
+				return engine.Bool(false)
+			}
+			ev, err := d.event(rec)
+			if err != nil {
+				return throw(err, "", env)
+			}
+			return d.delay(func(context.Context) *engine.Promise {
+				return engine.Unify(event, ev, k, env)
+			}, next)
+		}
+		return next(ctx)
+	})
+}
+
+// ExportTableFile (export_table/2) writes every item of Table to the file Path as JSON Lines in DynamoDB JSON format,
+// the same format as DynamoDB's export to S3. See ExportTable.
+// Requires a file system that can create files (see WithFS), otherwise it throws error(permission_error(open, source_sink, Path), _).
+//
+//	export_table(+Table, +Path).
+func (d Dynamo) ExportTableFile(table, path engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.ExportTableFileWithOptions(table, path, engine.Atom("[]"), k, env)
+}
+
+// ExportTableFileWithOptions (export_table/3) is like export_table/2 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if the export takes longer than Ms milliseconds.
+//
+//	export_table(+Table, +Path, +Options).
+func (d Dynamo) ExportTableFileWithOptions(table, path, options engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	conn, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	name, err := atomArg(path, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	timeout, err := timeoutOption(options, "export_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	if conn.fsys == nil {
+		return engine.Error(engine.SystemError(errors.New("dynamodb: export_table/2 requires a file system, see WithFS")))
+	}
+	fsys, ok := conn.fsys.(CreateFS)
+	if !ok {
+		return engine.Error(engine.PermissionError(engine.OperationOpen, engine.PermissionTypeSourceSink, engine.Atom(name), env))
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		f, err := fsys.Create(name)
+		if err != nil {
+			return engine.Error(engine.PermissionError(engine.OperationOpen, engine.PermissionTypeSourceSink, engine.Atom(name), env))
+		}
+		_, err = conn.ExportTable(ctx, from, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return throw(err, from, env)
+		}
+		return k(env)
+	})
+}
+
+// ImportTableFile (import_table/2) puts every item of the file Path, in the format written by export_table/2, into Table.
+// Existing items with the same key are replaced. See ImportTable.
+// Requires a file system (see WithFS). If Path doesn't exist, it throws error(existence_error(source_sink, Path), _).
+//
+//	import_table(+Table, +Path).
+func (d Dynamo) ImportTableFile(table, path engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	return d.ImportTableFileWithOptions(table, path, engine.Atom("[]"), k, env)
+}
+
+// ImportTableFileWithOptions (import_table/3) is like import_table/2 but takes a list of options:
+// timeout(Ms) throws time_limit_exceeded if the import takes longer than Ms milliseconds.
+//
+//	import_table(+Table, +Path, +Options).
+func (d Dynamo) ImportTableFileWithOptions(table, path, options engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	conn, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	name, err := atomArg(path, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	timeout, err := timeoutOption(options, "import_option", env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	if conn.fsys == nil {
+		return engine.Error(engine.SystemError(errors.New("dynamodb: import_table/2 requires a file system, see WithFS")))
+	}
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		ctx, cancel := withDeadline(ctx, deadlineAfter(timeout))
+		defer cancel()
+		f, err := conn.fsys.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return engine.Error(engine.ExistenceError(engine.ObjectTypeSourceSink, engine.Atom(name), env))
+		}
+		if err != nil {
+			return engine.Error(engine.PermissionError(engine.OperationOpen, engine.PermissionTypeSourceSink, engine.Atom(name), env))
+		}
+		defer f.Close()
+		if _, err := conn.ImportTable(ctx, from, f); err != nil {
+			return throw(err, from, env)
+		}
+		return k(env)
+	})
+}
+
+// DynamoSchema (dynamo_schema/2) declares the schema of Table, usually as a directive:
+//
+//	:- dynamo_schema(users, [key('UserID', n), sort('Time', s), attr(email, s, required), attr(tags, ss)]).
+//
+// Spec is a list of key(Name, Type), sort(Name, Type), attr(Name, Type), and attr(Name, Type, required | optional),
+// where Type is one of s, n, b, bool, null, ss, ns, bs, l, or m.
+// Items written by put_item, batch_write, transact, and import_table are checked before they are sent:
+// a missing required attribute throws error(domain_error(required(Name), Item), _)
+// and an attribute of the wrong type throws error(type_error(Type, Name-Value), _).
+// So are update_item and transact update actions: a value of the wrong type throws the same type_error
+// and removing a required attribute throws error(domain_error(required(Name), remove(Name)), _).
+// Conditional and existing attributes aren't checked.
+// Undeclared attributes are allowed. Declaring a table again replaces its schema.
+//
+//	dynamo_schema(+Table, +Spec).
+func (d Dynamo) DynamoSchema(table, spec engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, name, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	schema, err := declare(spec, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	d.decls.mu.Lock()
+	d.decls.schemas[name] = schema
+	d.decls.mu.Unlock()
+	return k(env)
+}
+
+// DynamoFact (dynamo_fact/3) reads Table as if it were facts, succeeding for every item whose attributes Attrs
+// unify with Values, the plain values of the attributes (see attribute_value/2). Missing attributes are null(true).
+// If Values has the table's partition and sort key bound, it gets that item. If it only has the partition key, it queries
+// the partition. Otherwise, it scans the table. Other bound values are checked after the items are read.
+// dynamo_table/3 defines predicates that call dynamo_fact/3:
+//
+//	:- dynamo_table(user/3, users, ['UserID', 'Name', 'Email']).
+//	% user(ID, Name, Email) :- dynamo_fact(users, ['UserID', 'Name', 'Email'], [ID, Name, Email]).
+//
+//	dynamo_fact(+Table, +Attrs, ?Values).
+func (d Dynamo) DynamoFact(table, attrs, values engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	d, from, ex := d.resolve(table, env)
+	if ex != nil {
+		return engine.Error(ex)
+	}
+	names, err := attrNames(attrs, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+
+	args := freshArgs(len(names))
+	return engine.Unify(values, engine.List(args...), func(env *engine.Env) *engine.Promise {
+		return d.delay(func(ctx context.Context) *engine.Promise {
+			return d.eachFact(ctx, from, names, args, func(item map[string]*dynamodb.AttributeValue) *engine.Promise {
+				vals, err := factValues(item, names)
+				if err != nil {
+					return throw(err, from, env)
+				}
+				return engine.Unify(engine.List(args...), vals, k, env)
+			}, env)
+		})
+	}, env)
+}
+
+// DynamoAssert (dynamo_assert/1) puts Fact into the table behind its predicate, defined with dynamo_table/3.
+// Arguments that are null(true) are left out of the item. Key values are converted to the key's type.
+// If Fact's predicate isn't defined with dynamo_table/3, it throws error(existence_error(dynamo_table, Name/Arity), _).
+//
+//	dynamo_assert(+Fact).
+func (d Dynamo) DynamoAssert(fact engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	ft, args, err := d.facts.lookup(fact, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	conn := d.connection(ft.conn)
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		s, err := conn.schema(ctx, ft.table)
+		if err != nil {
+			return throw(err, ft.table, env)
+		}
+		pairs := make([]engine.Term, 0, len(args))
+		for i, attr := range ft.attrs {
+			v := env.Resolve(args[i])
+			if null, ok := v.(engine.Compound); ok && null.Functor() == "null" && null.Arity() == 1 && env.Resolve(null.Arg(0)) == engine.Atom("true") {
+				continue
+			}
+			if attr == s.pk || attr == s.sk {
+				av, err := s.value(attr, v, env)
+				if err != nil {
+					return engine.Error(err)
+				}
+				v = av2prolog(av)
+			}
+			pairs = append(pairs, pair(attr, v))
+		}
+		return conn.PutItem(engine.Atom(ft.table), engine.List(pairs...), k, env)
+	})
+}
+
+// DynamoRetract (dynamo_retract/1) deletes the items of the table behind Fact's predicate, defined with dynamo_table/3,
+// that unify with Fact, one for every solution.
+// If Fact's predicate isn't defined with dynamo_table/3, it throws error(existence_error(dynamo_table, Name/Arity), _).
+//
+//	dynamo_retract(+Fact).
+func (d Dynamo) DynamoRetract(fact engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	ft, args, err := d.facts.lookup(fact, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	conn := d.connection(ft.conn)
+
+	return d.delay(func(ctx context.Context) *engine.Promise {
+		s, err := conn.schema(ctx, ft.table)
+		if err != nil {
+			return throw(err, ft.table, env)
+		}
+		return conn.eachFact(ctx, ft.table, ft.attrs, args, func(item map[string]*dynamodb.AttributeValue) *engine.Promise {
+			vals, err := factValues(item, ft.attrs)
+			if err != nil {
+				return throw(err, ft.table, env)
+			}
+			return engine.Unify(engine.List(args...), vals, func(env *engine.Env) *engine.Promise {
+				key := []engine.Term{pair(s.pk, av2prolog(item[s.pk]))}
+				if s.sk != "" {
+					key = append(key, pair(s.sk, av2prolog(item[s.sk])))
+				}
+				return conn.DeleteItem(engine.Atom(ft.table), engine.List(key...), k, env)
+			}, env)
+		}, env)
+	})
+}
+
+// iterate unifies item with each result of iter, lazily fetching more on backtracking.
+// table is the table being read, used for errors.
+func (d Dynamo) iterate(table string, iter dynamo.Iter, item engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	var next func(context.Context) *engine.Promise
+	next = func(ctx context.Context) *engine.Promise {
+		var result map[string]*dynamodb.AttributeValue
+		if !iter.NextWithContext(ctx, &result) {
+			// done
+			if err := iter.Err(); err != nil {
+				return throw(err, table, env)
+			}
+			return engine.Bool(false)
+		}
+		value, err := d.item2prolog(result)
+		if err != nil {
+			return throw(err, table, env)
+		}
+		return d.delay(func(context.Context) *engine.Promise {
+			return engine.Unify(item, value, k, env)
+		}, next)
+	}
+	return d.delay(next)
+}
+
+// item2prolog converts item into a key-value list, simplifying the values in plain value mode.
+func (d Dynamo) item2prolog(item map[string]*dynamodb.AttributeValue) (engine.Term, error) {
+	if !d.plain {
+		return item2prolog(item), nil
+	}
+	return plainItem(item)
+}
+
 func (d Dynamo) AttributeValue(attribute, value engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
 	switch attribute := env.Resolve(attribute).(type) {
 	case engine.Variable:
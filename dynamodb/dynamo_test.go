@@ -1,14 +1,25 @@
 package dynamodb
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/guregu/dynamo"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/ichiban/prolog/engine"
 
+	"github.com/guregu/predicates/dynamodb/dynamotest"
 	"github.com/guregu/predicates/internal"
 )
 
@@ -18,78 +29,1141 @@ var (
 	fail  = []map[string]engine.Term(nil)
 )
 
-func newDB() *dynamo.DB {
-	db := dynamo.New(session.New(), &aws.Config{
-		Region:   aws.String("test"),
-		Endpoint: aws.String("http://localhost:8880"),
-		// LogLevel: aws.LogLevel(aws.LogDebugWithHTTPBody),
-	})
-	return db
+// newFake returns a Prolog interpreter using an in-memory DynamoDB with a users table.
+func newFake(t *testing.T) *internal.TestProlog {
+	p := internal.NewTestProlog()
+	ddb := NewFromIface(dynamotest.New())
+	ddb.Register(p.Interpreter)
+	p.MustExec(t, `:- create_table(users, [key_schema-['UserID'-hash, 'Time'-range], attributes-['UserID'-n, 'Time'-s]]).`)
+	p.MustExec(t, `:- put_item(users, ['UserID'-n(1), 'Time'-s('2001'), msg-s(a)]).`)
+	p.MustExec(t, `:- put_item(users, ['UserID'-n(1), 'Time'-s('2002'), msg-s(b)]).`)
+	p.MustExec(t, `:- put_item(users, ['UserID'-n(2), 'Time'-s('2001'), msg-s(c)]).`)
+	return p
 }
 
-// TODO: proper tests...
+// throws returns a test that fails unless goal throws an instance of ball.
+// Use _ in ball only for parts that can't be known, such as messages from DynamoDB.
+func throws(p *internal.TestProlog, goal, ball string) func(*testing.T) {
+	return func(t *testing.T) {
+		t.Helper()
+		sol := p.QuerySolution(`catch((` + goal + `, Thrown = no), Ball, Thrown = yes),
+			(Thrown == yes, subsumes_term(` + ball + `, Ball) -> OK = true ; OK = false).`)
+		if err := sol.Err(); err != nil {
+			t.Fatalf("%s: %v", goal, err)
+		}
+		got := make(map[string]engine.Term)
+		if err := sol.Scan(got); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case got["Thrown"] != engine.Atom("yes"):
+			t.Errorf("%s: succeeded, want %s", goal, ball)
+		case got["OK"] != engine.Atom("true"):
+			t.Errorf("%s: threw %s, want %s", goal, writeTerm(got["Ball"]), ball)
+		}
+	}
+}
 
 func TestListTables(t *testing.T) {
+	p := newFake(t)
+	p.MustExec(t, `:- create_table(accounts, [key_schema-['ID'-hash], attributes-['ID'-s]]).`)
+
+	t.Run("list_tables/1", p.Expect([]map[string]engine.Term{
+		{"T": engine.Atom("accounts")},
+		{"T": engine.Atom("users")},
+	}, "list_tables(T)."))
+}
+
+func TestDescribeTable(t *testing.T) {
+	p := newFake(t)
+	p.MustExec(t, `:- create_table(accounts, [
+		key_schema-['ID'-hash],
+		attributes-['ID'-s, email-s],
+		global_indexes-['ByEmail'-[key_schema-[email-hash], projection-keys_only]]
+	]).`)
+
+	t.Run("on-demand round trip", func(t *testing.T) {
+		p.MustExec(t, `:- describe_table(accounts, Info), \+ member(throughput-_, Info),
+			create_table(copy, Info), describe_table(copy, Copy),
+			member(billing_mode-pay_per_request, Copy), member(global_indexes-['ByEmail'-_], Copy).`)
+	})
+	t.Run("wait_table timeout", throws(p, `wait_table(accounts, deleting, [timeout(50)])`, `time_limit_exceeded`))
+	t.Run("provisioned round trip", func(t *testing.T) {
+		p.MustExec(t, `:- create_table(provisioned, [key_schema-['ID'-hash], attributes-['ID'-s], throughput-[read-5, write-1]]),
+			describe_table(provisioned, Info), create_table(copy2, Info), describe_table(copy2, Copy),
+			member(billing_mode-provisioned, Copy), member(throughput-[read-5, write-1], Copy).`)
+	})
+}
+
+func TestScan(t *testing.T) {
+	p := newFake(t)
+
+	t.Run("scan/2", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("a")},
+		{"Msg": engine.Atom("b")},
+		{"Msg": engine.Atom("c")},
+	}, "scan(users, Item), member(msg-s(Msg), Item)."))
+
+	t.Run("limit", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("a")},
+		{"Msg": engine.Atom("b")},
+	}, "scan(users, [limit(2), page_limit(1)], Item), member(msg-s(Msg), Item)."))
+}
+
+func TestScanPage(t *testing.T) {
+	p := newFake(t)
+
+	t.Run("pages", p.Expect([]map[string]engine.Term{
+		{"A": engine.List(engine.Atom("a"), engine.Atom("b")), "B": engine.List(engine.Atom("c")), "End": engine.Atom("end")},
+	}, `scan_page(users, [limit(2)], Page1, C1), C1 \== end,
+		scan_page(users, [limit(2), start(C1)], Page2, End),
+		findall(M, (member(I, Page1), member(msg-s(M), I)), A),
+		findall(M, (member(I, Page2), member(msg-s(M), I)), B).`))
+
+	t.Run("resume scan/3", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("b")},
+		{"Msg": engine.Atom("c")},
+	}, "scan_page(users, [limit(1)], _, C), scan(users, [start(C)], Item), member(msg-s(Msg), Item)."))
+
+	t.Run("end", p.Expect([]map[string]engine.Term{
+		{"Items": engine.Atom("[]"), "C": engine.Atom("end")},
+	}, "scan_page(users, [start(end)], Items, C)."))
+
+	t.Run("bad cursor", throws(p, `scan_page(users, [start('!!')], _, _)`, `error(domain_error(cursor, '!!'), _)`))
+}
+
+func TestPut(t *testing.T) {
+	p := newFake(t)
+
+	t.Run("put_item/2", p.Expect(okay, "put_item(users, ['UserID'-n(4002), 'Time'-s('2001'), msg-s(hi)]), OK = true."))
+	t.Run("get_item/3", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("hi")},
+	}, "get_item(users, key(4002, '2001'), Item), member(msg-s(Msg), Item)."))
+	t.Run("delete_item/2", p.Expect([]map[string]engine.Term{
+		{"N": engine.Integer(3)},
+	}, "delete_item(users, ['UserID'-4002, 'Time'-'2001']), findall(X, scan(users, X), Xs), length(Xs, N)."))
+}
+
+func TestQuery(t *testing.T) {
+	p := newFake(t)
+
+	t.Run("partition", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("a")},
+		{"Msg": engine.Atom("b")},
+	}, "query(users, 'UserID'-n(1), Item), member(msg-s(Msg), Item)."))
+
+	t.Run("sort key condition", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("b")},
+	}, "query(users, 'UserID'-1-&-('Time' > '2001'), Item), member(msg-s(Msg), Item)."))
+
+	t.Run("descending", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("b")},
+	}, "query(users, 'UserID'-1, [order(desc), limit(1)], Item), member(msg-s(Msg), Item)."))
+
+	t.Run("wrong key", throws(p, `query(users, msg-a, _)`, `error(domain_error(key_schema(['UserID'-n, 'Time'-s]), msg-a), _)`))
+}
+
+func TestIndexQuery(t *testing.T) {
+	p := newFake(t)
+	p.MustExec(t, `:- create_table(accounts, [
+		key_schema-['ID'-hash],
+		attributes-['ID'-s, email-s, created-n],
+		global_indexes-['ByEmail'-[key_schema-[email-hash, created-range], projection-include([name])]]
+	]).`)
+	p.MustExec(t, `:- put_item(accounts, ['ID'-s(a), email-s('a@example.com'), created-n(1), name-s(alice), age-n(30)]).`)
+	p.MustExec(t, `:- put_item(accounts, ['ID'-s(b), email-s('a@example.com'), created-n(2), name-s(bob), age-n(40)]).`)
+
+	t.Run("projected", p.Expect([]map[string]engine.Term{
+		{"Item": engine.List(
+			engine.Atom("-").Apply(engine.Atom("ID"), engine.Atom("s").Apply(engine.Atom("b"))),
+			engine.Atom("-").Apply(engine.Atom("created"), engine.Atom("n").Apply(engine.Atom("2"))),
+			engine.Atom("-").Apply(engine.Atom("email"), engine.Atom("s").Apply(engine.Atom("a@example.com"))),
+			engine.Atom("-").Apply(engine.Atom("name"), engine.Atom("s").Apply(engine.Atom("bob"))),
+		)},
+	}, "index_query(accounts, 'ByEmail', email-'a@example.com'-&-(created > 1), Item)."))
+
+	t.Run("pattern", p.Expect([]map[string]engine.Term{
+		{"Name": engine.Atom("alice")},
+		{"Name": engine.Atom("bob")},
+	}, "index_query(accounts, 'ByEmail', email-'a@example.com', ['ID'-_, created-_, email-_, name-s(Name)])."))
+
+	t.Run("not projected", throws(p, `index_query(accounts, 'ByEmail', email-'a@example.com', [age-_|_])`,
+		`error(domain_error(index_projection('ByEmail', ['ID', email, created, name]), age), _)`))
+
+	t.Run("wrong key", throws(p, `index_query(accounts, 'ByEmail', 'ID'-a, _)`, `error(domain_error(key_schema([email-s, created-n]), 'ID'-a), _)`))
+	t.Run("wrong sort key", throws(p, `index_query(accounts, 'ByEmail', email-a-&-name-b, _)`, `error(domain_error(key_schema([email-s, created-n]), email-a-&-name-b), _)`))
+	t.Run("unknown index", throws(p, `index_query(accounts, 'ByName', name-a, _)`, `error(existence_error(index, 'ByName'), _)`))
+
+	t.Run("options", func(t *testing.T) {
+		p.MustExec(t, `:- findall(ID, index_query(accounts, 'ByEmail', email-'a@example.com', [order(desc), limit(1)], ['ID'-s(ID)|_]), [b]).`)
+		p.MustExec(t, `:- findall(ID, index_query(accounts, 'ByEmail', email-'a@example.com', [index('ByEmail'), timeout(1000)], ['ID'-s(ID)|_]), [a, b]).`)
+		throws(p, `index_query(accounts, 'ByEmail', email-'a@example.com', [index('ByName')], _)`, `error(domain_error(query_option, index('ByName')), _)`)(t)
+		throws(p, `index_query(accounts, 'ByEmail', email-'a@example.com', [frob], _)`, `error(type_error(compound, frob), index_query/5)`)(t)
+		throws(p, `index_query(accounts, 'ByEmail', email-'a@example.com', [limit(1)], [age-_|_])`, `error(domain_error(index_projection('ByEmail', ['ID', email, created, name]), age), _)`)(t)
+	})
+}
+
+func TestPlainValues(t *testing.T) {
 	p := internal.NewTestProlog()
-	ddb := New(newDB())
+	ddb := NewFromIface(dynamotest.New()).WithPlainValues()
 	ddb.Register(p.Interpreter)
+	p.MustExec(t, `:- create_table(things, [key_schema-['ID'-hash], attributes-['ID'-s]]).`)
+
+	const item = `['ID'-a, bin-b('AQI='), bins-set([b('AQI=')]), empty-[], flag-bool(true), list-[1, x], map-[k-v],
+		mt-m([]), n-42, nil-null(true), nums-set([1, 2]), str-s('[]'), strs-set([x, y])]`
+	p.MustExec(t, `:- put_item(things, `+item+`).`)
+
+	t.Run("get_item", p.Expect([]map[string]engine.Term{
+		{"Map": engine.List(engine.Atom("-").Apply(engine.Atom("k"), engine.Atom("v"))), "N": engine.Integer(42)},
+	}, "get_item(things, 'ID'-a, Item), member(map-Map, Item), member(n-N, Item)."))
 
-	// t.Run("list_tables/1", p.Expect(nil, "list_tables(X)."))
+	t.Run("round trip", p.Expect(okay, "get_item(things, 'ID'-a, Item), Item = "+item+", OK = true."))
 
-	// t.Run("test", p.Expect(nil, "list_tables(T), once(scan(T, Item)), write(Item)."))
+	t.Run("scan", p.Expect([]map[string]engine.Term{
+		{"Nums": engine.Atom("set").Apply(engine.List(engine.Integer(1), engine.Integer(2)))},
+	}, "scan(things, Item), member(nums-Nums, Item)."))
 }
 
-func TestScan(t *testing.T) {
+func TestStreamRecord(t *testing.T) {
+	p := internal.NewTestProlog()
+	db := dynamotest.New()
+	ddb := NewFromIface(db).WithStreams(db.Streams())
+	ddb.Register(p.Interpreter)
+	p.MustExec(t, `:- create_table(events, [key_schema-['ID'-hash], attributes-['ID'-s], stream-new_and_old_images]).`)
+	p.MustExec(t, `:- create_table(keys, [key_schema-['ID'-hash], attributes-['ID'-s], stream-keys_only]).`)
+	p.MustExec(t, `:- create_table(quiet, [key_schema-['ID'-hash], attributes-['ID'-s]]).`)
+	for _, table := range []string{"events", "keys"} {
+		p.MustExec(t, `:- put_item(`+table+`, ['ID'-s(a), n-n(1)]).`)
+		p.MustExec(t, `:- put_item(`+table+`, ['ID'-s(a), n-n(2)]).`)
+		p.MustExec(t, `:- delete_item(`+table+`, 'ID'-s(a)).`)
+	}
+
+	id := engine.Atom("-").Apply(engine.Atom("ID"), engine.Atom("s").Apply(engine.Atom("a")))
+	n := func(v int) engine.Term {
+		return engine.Atom("-").Apply(engine.Atom("n"), engine.Atom("n").Apply(engine.Atom(strconv.Itoa(v))))
+	}
+	t.Run("new and old images", p.Expect([]map[string]engine.Term{
+		{"Event": engine.Atom("insert").Apply(engine.List(id, n(1)))},
+		{"Event": engine.Atom("modify").Apply(engine.List(id, n(1)), engine.List(id, n(2)))},
+		{"Event": engine.Atom("remove").Apply(engine.List(id))},
+	}, "stream_record(events, Event)."))
+
+	t.Run("keys only", p.Expect([]map[string]engine.Term{
+		{"Event": engine.Atom("insert").Apply(engine.List(id))},
+		{"Event": engine.Atom("modify").Apply(engine.List(id), engine.List(id))},
+		{"Event": engine.Atom("remove").Apply(engine.List(id))},
+	}, "stream_record(keys, Event)."))
+
+	t.Run("describe_table", p.Expect(okay, "describe_table(events, Info), member(stream-new_and_old_images, Info), OK = true."))
+	t.Run("no stream", throws(p, `stream_record(quiet, _)`, `error(existence_error(stream, quiet), _)`))
+}
+
+func TestTTL(t *testing.T) {
 	p := internal.NewTestProlog()
-	ddb := New(newDB())
+	db := dynamotest.New()
+	ddb := NewFromIface(db)
 	ddb.Register(p.Interpreter)
+	p.MustExec(t, `:- create_table(sessions, [key_schema-['User'-hash, 'ID'-range], attributes-['User'-s, 'ID'-s]]).`)
+	p.MustExec(t, `:- create_table(forever, [key_schema-['ID'-hash], attributes-['ID'-s]]).`)
 
-	sols, err := p.Interpreter.Query("list_tables(T), once(scan(T, Item)), write(Item), nl.")
+	t.Run("disabled", throws(p, `put_item(forever, ['ID'-s(a)], [ttl(60)])`, `error(existence_error(time_to_live, forever), _)`))
+
+	_, err := db.UpdateTimeToLiveWithContext(context.Background(), &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String("sessions"),
+		TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+			AttributeName: aws.String("expires"),
+			Enabled:       aws.Bool(true),
+		},
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	for sols.Next() {
-		m := make(map[string]engine.Term)
-		if err := sols.Scan(m); err != nil {
-			t.Fatal(err)
+	p.MustExec(t, `:- put_item(sessions, ['User'-s(u), 'ID'-s(old)], [expires_at(1000000000)]).`)
+	p.MustExec(t, `:- put_item(sessions, ['User'-s(u), 'ID'-s(new)], [ttl(3600)]).`)
+	p.MustExec(t, `:- put_item(sessions, ['User'-s(u), 'ID'-s(none)]).`)
+
+	t.Run("expires_at", p.Expect([]map[string]engine.Term{
+		{"Exp": engine.Atom("1000000000")},
+	}, "get_item(sessions, 'User'-s(u)-&-'ID'-s(old), Item), member(expires-n(Exp), Item)."))
+
+	t.Run("ttl", func(t *testing.T) {
+		now := time.Now().Unix()
+		p.Expect(okay, fmt.Sprintf("get_item(sessions, 'User'-s(u)-&-'ID'-s(new), Item), member(expires-Exp, Item), attribute_value(Exp, N), N >= %d, N =< %d, OK = true.", now+3600-5, now+3600+5))(t)
+	})
+
+	ids := []map[string]engine.Term{
+		{"ID": engine.Atom("new")},
+		{"ID": engine.Atom("none")},
+	}
+	t.Run("scan", p.Expect(ids, "scan(sessions, [skip_expired(true)], Item), member('ID'-s(ID), Item)."))
+	t.Run("scan limit", p.Expect(ids[:1], "scan(sessions, [skip_expired(true), limit(1)], Item), member('ID'-s(ID), Item)."))
+	t.Run("scan_page", p.Expect([]map[string]engine.Term{
+		{"N": engine.Integer(2)},
+	}, "scan_page(sessions, [skip_expired(true)], Items, _), length(Items, N)."))
+	t.Run("query", p.Expect(ids, "query(sessions, 'User'-s(u), [skip_expired(true)], Item), member('ID'-s(ID), Item)."))
+	t.Run("query limit", p.Expect(ids[:1], "query(sessions, 'User'-s(u), [limit(1), skip_expired(true)], Item), member('ID'-s(ID), Item)."))
+	t.Run("query expired", p.Expect([]map[string]engine.Term{
+		{"ID": engine.Atom("old")},
+	}, "query(sessions, 'User'-s(u), [limit(1)], Item), member('ID'-s(ID), Item)."))
+	t.Run("required by schema", func(t *testing.T) {
+		p.MustExec(t, `:- dynamo_schema(sessions, [key('User', s), sort('ID', s), attr(expires, n, required)]).`)
+		p.MustExec(t, `:- put_item(sessions, ['User'-s(v), 'ID'-s(a)], [ttl(60)]).`)
+		throws(p, `put_item(sessions, ['User'-s(v), 'ID'-s(b)])`, `error(domain_error(required(expires), ['ID'-s(b), 'User'-s(v)]), _)`)(t)
+	})
+	t.Run("delete_item", throws(p, `delete_item(sessions, 'User'-s(u)-&-'ID'-s(old), [ttl(1)])`, `error(domain_error(write_option, ttl(1)), _)`))
+}
+
+func TestErrors(t *testing.T) {
+	p := newFake(t)
+
+	t.Run("missing item", p.Expect(fail, "get_item(users, 'UserID'-n(9)-&-'Time'-s('2001'), _)."))
+	t.Run("missing table", throws(p, `scan(nope, _)`, `error(existence_error(table, nope), dynamodb_error(resource_not_found, _))`))
+	t.Run("missing table key", throws(p, `get_item(nope, key(1), _)`, `error(existence_error(table, nope), dynamodb_error(resource_not_found, _))`))
+	t.Run("other", throws(p, `create_table(users, [key_schema-[id-hash], attributes-[id-s]])`, `error(dynamodb_error(resource_in_use, _), _)`))
+	t.Run("table type", throws(p, `get_item(42, 'UserID'-n(1), _)`, `error(type_error(atom, 42), get_item/3)`))
+	t.Run("table variable", throws(p, `scan(_, _)`, `error(instantiation_error, scan/2)`))
+	t.Run("bad values", func(t *testing.T) {
+		throws(p, `put_item(users, ['UserID'-n(3), 'Time'-s(x), a-bool(maybe)])`, `error(domain_error(boolean, maybe), _)`)(t)
+		throws(p, `put_item(users, ['UserID'-n(3), 'Time'-s(x), a-null(false)])`, `error(domain_error(attribute_value, null(false)), _)`)(t)
+		throws(p, `put_item(users, ['UserID'-n(3), 'Time'-s(x), a-foo(1)])`, `error(domain_error(attribute_value, foo(1)), _)`)(t)
+		throws(p, `put_item(users, ['UserID'-n(3), 'Time'-s(x), a-b('!!')])`, `error(domain_error(base64, '!!'), _)`)(t)
+		throws(p, `put_item(users, ['UserID'-n(3), 'Time'-s(x), a-bs(['!!'])])`, `error(domain_error(base64, '!!'), _)`)(t)
+	})
+	t.Run("not configured", func(t *testing.T) {
+		throws(p, `stream_record(users, _)`, `error(system_error, 'dynamodb: stream_record/2 requires a DynamoDB Streams client, see WithStreams')`)(t)
+		throws(p, `export_table(users, 'users.jsonl')`, `error(system_error, 'dynamodb: export_table/2 requires a file system, see WithFS')`)(t)
+		throws(p, `import_table(users, 'users.jsonl')`, `error(system_error, 'dynamodb: import_table/2 requires a file system, see WithFS')`)(t)
+	})
+
+	t.Run("throughput", func(t *testing.T) {
+		p := internal.NewTestProlog()
+		rec := &recorder{
+			rows: []*dynamodb.ExecuteStatementOutput{{}},
+			err:  awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil),
 		}
-		fmt.Println(m)
+		NewFromIface(rec).Register(p.Interpreter)
+		throws(p, `execute_statement('SELECT * FROM test', [], _)`, `error(resource_error(throughput), dynamodb_error(provisioned_throughput_exceeded, 'slow down'))`)(t)
+	})
+}
+
+func TestCache(t *testing.T) {
+	db := dynamotest.New()
+	p := internal.NewTestProlog()
+	ddb := NewFromIface(db).WithCache(2, time.Hour)
+	ddb.Register(p.Interpreter)
+	// writes by another client aren't seen by the cache
+	other := internal.NewTestProlog()
+	NewFromIface(db).Register(other.Interpreter)
+
+	p.MustExec(t, `:- create_table(config, [key_schema-[name-hash], attributes-[name-s]]).`)
+	p.MustExec(t, `:- put_item(config, [name-s(color), value-s(red)]).`)
+
+	get := func(want engine.Term, query string) func(*testing.T) {
+		if want == nil {
+			return p.Expect(fail, query)
+		}
+		return p.Expect([]map[string]engine.Term{{"V": want}}, query)
 	}
-	if err := sols.Err(); err != nil {
-		t.Error(err)
+
+	t.Run("miss", get(engine.Atom("red"), "get_item(config, key(color), Item), member(value-s(V), Item)."))
+	other.MustExec(t, `:- put_item(config, [name-s(color), value-s(blue)]).`)
+	t.Run("hit", get(engine.Atom("red"), "get_item(config, key(color), Item), member(value-s(V), Item)."))
+	t.Run("consistent", get(engine.Atom("blue"), "get_item(config, key(color), [consistent(true)], Item), member(value-s(V), Item)."))
+	t.Run("refreshed", get(engine.Atom("blue"), "get_item(config, key(color), Item), member(value-s(V), Item)."))
+
+	p.MustExec(t, `:- put_item(config, [name-s(color), value-s(green)]).`)
+	t.Run("put_item invalidates", get(engine.Atom("green"), "get_item(config, key(color), Item), member(value-s(V), Item)."))
+	p.MustExec(t, `:- delete_item(config, key(color)).`)
+	t.Run("delete_item invalidates", get(nil, "get_item(config, key(color), _)."))
+	other.MustExec(t, `:- put_item(config, [name-s(color), value-s(red)]).`)
+	t.Run("missing items are cached", get(nil, "get_item(config, key(color), _)."))
+
+	p.MustExec(t, `:- put_item(config, [name-s(size), value-s(big)]).`)
+	p.MustExec(t, `:- put_item(config, [name-s(shape), value-s(round)]).`)
+	t.Run("evicted", get(engine.Atom("red"), `get_item(config, key(size), _), get_item(config, key(shape), _),
+		get_item(config, key(color), Item), member(value-s(V), Item).`))
+
+	want := CacheStats{Hits: 3, Misses: 6}
+	if got := ddb.CacheStats(); got != want {
+		t.Errorf("bad stats. want: %+v got: %+v", want, got)
 	}
 }
 
-func TestPut(t *testing.T) {
-	t.Skip("needs table")
+func TestCacheNormalizedKeys(t *testing.T) {
+	db := dynamotest.New()
+	p := internal.NewTestProlog()
+	NewFromIface(db).WithCache(2, time.Hour).Register(p.Interpreter)
+
+	p.MustExec(t, `:- create_table(counters, [key_schema-[id-hash], attributes-[id-n]]).`)
+	p.MustExec(t, `:- put_item(counters, [id-n(1), v-s(a)]).`)
+	p.MustExec(t, `:- get_item(counters, key(1), Item), member(v-s(a), Item).`)
+	// the same item written with a differently formatted number
+	p.MustExec(t, `:- put_item(counters, [id-n('1.0'), v-s(b)]).`)
+	p.MustExec(t, `:- get_item(counters, key(1), Item), member(v-s(b), Item).`)
+	p.MustExec(t, `:- delete_item(counters, key(n('01'))).`)
+	p.MustExec(t, `:- \+ get_item(counters, key(1), _).`)
+}
+
+func TestDynamoTable(t *testing.T) {
+	p := newFake(t)
+	p.MustExec(t, `:- dynamo_table(user/3, users, ['UserID', 'Time', msg]).`)
+
+	t.Run("get", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("b")},
+	}, "user(1, '2002', Msg)."))
+	t.Run("get missing", p.Expect(fail, "user(1, '1999', _)."))
+	t.Run("query", p.Expect([]map[string]engine.Term{
+		{"Time": engine.Atom("2001"), "Msg": engine.Atom("a")},
+		{"Time": engine.Atom("2002"), "Msg": engine.Atom("b")},
+	}, "user(1, Time, Msg)."))
+	t.Run("scan", p.Expect([]map[string]engine.Term{
+		{"ID": engine.Integer(1)},
+		{"ID": engine.Integer(2)},
+	}, "user(ID, '2001', _)."))
+	t.Run("bad key type", p.Expect(fail, "user(abc, _, _)."))
+
+	t.Run("dynamo_assert", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("hello")},
+	}, "dynamo_assert(user(3, '2003', hello)), user(3, _, Msg)."))
+	t.Run("null", p.Expect([]map[string]engine.Term{
+		{"Item": engine.List(pair("Time", engine.Atom("s").Apply(engine.Atom("2004"))), pair("UserID", engine.Atom("n").Apply(engine.Atom("4"))))},
+	}, "dynamo_assert(user(4, '2004', null(true))), user(4, '2004', null(true)), get_item(users, key(4, '2004'), Item)."))
+	t.Run("dynamo_retract", p.Expect([]map[string]engine.Term{
+		{"Msgs": engine.List(engine.Atom("c"), engine.Atom("hello"), engine.Atom("null").Apply(engine.Atom("true")))},
+	}, "dynamo_retract(user(1, _, _)), \\+ user(1, _, _), findall(M, user(_, _, M), Msgs)."))
+
+	t.Run("dynamo_fact/3", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("c")},
+	}, "dynamo_fact(users, ['UserID', msg], [2, Msg])."))
+	t.Run("undefined", throws(p, `dynamo_assert(nope(1))`, `error(existence_error(dynamo_table, nope/1), _)`))
+	t.Run("wrong arity", throws(p, `dynamo_table(user/2, users, [a])`, `error(domain_error(dynamo_table_attributes, [a]), _)`))
+}
+
+func TestConnections(t *testing.T) {
+	p := internal.NewTestProlog()
+	ddb := NewFromIface(dynamotest.New()).WithConnection("staging", NewFromIface(dynamotest.New()))
+	ddb.Register(p.Interpreter)
+	p.MustExec(t, `:- create_table(users, [key_schema-['UserID'-hash], attributes-['UserID'-n]]).`)
+	p.MustExec(t, `:- create_table(staging:users, [key_schema-['UserID'-hash], attributes-['UserID'-n]]).`)
+	p.MustExec(t, `:- create_table(staging:accounts, [key_schema-['ID'-hash], attributes-['ID'-s]]).`)
+
+	t.Run("list_tables", p.Expect([]map[string]engine.Term{
+		{"T": engine.Atom("accounts")},
+		{"T": engine.Atom("users")},
+	}, "list_tables(staging:T)."))
+	t.Run("put and get", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("hi")},
+	}, "put_item(staging:users, ['UserID'-n(1), msg-s(hi)]), get_item(staging:users, key(1), Item), member(msg-s(Msg), Item)."))
+	t.Run("default connection", p.Expect(fail, "get_item(users, key(1), _)."))
+	t.Run("transact", throws(p, `transact([put(users, ['UserID'-n(2)]), put(staging:users, ['UserID'-n(2)])])`, `error(domain_error(same_connection, put(staging:users, ['UserID'-n(2)])), _)`))
+	t.Run("unknown", throws(p, `scan(nope:users, _)`, `error(existence_error(connection, nope), _)`))
+	t.Run("dynamo_table", p.Expect([]map[string]engine.Term{
+		{"Msg": engine.Atom("hi")},
+	}, "dynamo_table(staged/2, staging:users, ['UserID', msg]), staged(1, Msg)."))
+}
+
+func TestMetrics(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	db := dynamotest.New()
+	p := internal.NewTestProlog()
+	ddb := NewFromIface(db).WithMetrics(func(m Metric) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, m.Predicate+" "+m.Operation)
+	})
+	ddb.Register(p.Interpreter)
+	p.MustExec(t, `:- create_table(users, [key_schema-['UserID'-hash, 'Time'-range], attributes-['UserID'-n, 'Time'-s]]).`)
+	p.MustExec(t, `:- put_item(users, ['UserID'-n(1), 'Time'-s('2001'), msg-s(a)]).`)
+	p.MustExec(t, `:- put_item(users, ['UserID'-n(1), 'Time'-s('2002'), msg-s(b)]).`)
+
+	t.Run("dynamo_stats", p.Expect([]map[string]engine.Term{
+		{"N": engine.Integer(2), "C": engine.Float(1), "T": engine.List(pair("users", engine.Float(1)))},
+	}, `get_item(users, key(1, '2001'), _), get_item(users, key(1, '2002'), _),
+		dynamo_stats(S), member((get_item/3)-Info, S), member(requests-N, Info), member(capacity-C, Info), member(tables-T, Info).`))
+
+	t.Run("Stats", func(t *testing.T) {
+		p.MustExec(t, `:- findall(I, query(users, 'UserID'-n(1), I), _).`)
+		stats := ddb.Stats()
+		if got := stats["put_item/2"]; got.Requests != 2 || got.Capacity != 2 || got.Errors != 0 {
+			t.Error("unexpected put_item/2 stats:", got)
+		}
+		if got := stats["query/3"]; got.Requests != 1 || got.Tables["users"] != 1 {
+			t.Error("unexpected query/3 stats:", got)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		want := []string{"put_item/2 PutItem", "put_item/2 PutItem", "get_item/3 GetItem", "get_item/3 GetItem", "query/3 Query"}
+		if fmt.Sprint(requests) != fmt.Sprint(want) {
+			t.Error("unexpected requests. want:", want, "got:", requests)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		// the table's key schema is cached, so get_item/3 only finds out when it makes the request
+		other := internal.NewTestProlog()
+		NewFromIface(db).Register(other.Interpreter)
+		other.MustExec(t, `:- delete_table(users).`)
+		throws(p, `get_item(users, key(1, '2001'), _)`, `error(existence_error(table, users), dynamodb_error(resource_not_found, _))`)(t)
+		if got := ddb.Stats()["get_item/3"]; got.Requests != 3 || got.Errors != 1 {
+			t.Error("unexpected get_item/3 stats:", got)
+		}
+	})
+
+	t.Run("disabled", newFake(t).Expect([]map[string]engine.Term{
+		{"S": engine.List()},
+	}, "get_item(users, key(1, '2001'), _), dynamo_stats(S)."))
+
+	t.Run("one client", func(t *testing.T) {
+		// every predicate shares the DB wrapped by WithMetrics
+		if ddb.meter("get_item/3").db != ddb.db || ddb.meter("put_item/2").db != ddb.db {
+			t.Error("meter rebuilt the DB")
+		}
+		again := ddb.WithMetrics(nil)
+		if mc, ok := again.db.Client().(*meteredClient); !ok || mc.DynamoDBAPI != db {
+			t.Errorf("want a single metered client around the original, got: %#v", again.db.Client())
+		}
+	})
+
+	t.Run("connections", func(t *testing.T) {
+		p := internal.NewTestProlog()
+		other := dynamotest.New()
+		ddb := NewFromIface(db).WithConnection("other", NewFromIface(other)).WithMetrics(nil)
+		ddb.Register(p.Interpreter)
+		p.MustExec(t, `:- create_table(other:users, [key_schema-[id-hash], attributes-[id-s]]).`)
+		p.MustExec(t, `:- put_item(other:users, [id-s(a)]).`)
+		if got := ddb.Stats()["put_item/2"]; got.Requests != 1 || got.Tables["users"] != 1 {
+			t.Error("unexpected put_item/2 stats:", got)
+		}
+	})
+}
+
+func TestDynamoSchema(t *testing.T) {
+	p := newFake(t)
+	p.MustExec(t, `:- dynamo_schema(users, [key('UserID', n), sort('Time', s), attr(email, s, required), attr(age, n)]).`)
+
+	t.Run("valid", p.Expect(okay, "put_item(users, ['UserID'-n(3), 'Time'-s('2001'), email-s('a@example.com'), age-n(20), extra-bool(true)]), OK = true."))
+	t.Run("missing", throws(p, `put_item(users, ['UserID'-n(3), 'Time'-s('2001')])`, `error(domain_error(required(email), ['Time'-s('2001'), 'UserID'-n('3')]), _)`))
+	t.Run("missing key", throws(p, `put_item(users, ['Time'-s('2001'), email-s(x)])`, `error(domain_error(required('UserID'), ['Time'-s('2001'), email-s(x)]), _)`))
+	t.Run("wrong type", throws(p, `put_item(users, ['UserID'-n(3), 'Time'-s('2001'), email-s(x), age-s(old)])`, `error(type_error(n, age-s(old)), _)`))
+	t.Run("batch_write", func(t *testing.T) {
+		throws(p, `batch_write(users, [put(['UserID'-n(4), 'Time'-s('2001'), email-s(x)]), put(['UserID'-s(x), 'Time'-s('2001'), email-s(x)])])`,
+			`error(type_error(n, 'UserID'-s(x)), _)`)(t)
+		// nothing was written
+		p.MustExec(t, `:- findall(X, scan(users, X), Xs), length(Xs, 4).`)
+	})
+	t.Run("transact", throws(p, `transact([put(users, ['UserID'-n(4), 'Time'-s('2001')])])`, `error(domain_error(required(email), ['Time'-s('2001'), 'UserID'-n('4')]), _)`))
+	t.Run("update_item", func(t *testing.T) {
+		throws(p, `update_item(users, ['UserID'-n(3), 'Time'-s('2001')], [set(age, s(old))])`, `error(type_error(n, age-s(old)), _)`)(t)
+		throws(p, `update_item(users, ['UserID'-n(3), 'Time'-s('2001')], [remove(email)])`, `error(domain_error(required(email), remove(email)), _)`)(t)
+		throws(p, `transact([update(users, ['UserID'-n(3), 'Time'-s('2001')], [add(age, s(x))])])`, `error(type_error(n, age-s(x)), _)`)(t)
+	})
+	t.Run("other tables", p.Expect(okay, "dynamo_schema(accounts, [key('ID', s)]), put_item(users, ['UserID'-n(5), 'Time'-s('2001'), email-s(x)]), OK = true."))
+
+	t.Run("bad type", throws(p, `dynamo_schema(users, [attr(x, string)])`, `error(domain_error(attribute_type, string), _)`))
+	t.Run("bad key type", throws(p, `dynamo_schema(users, [key(x, ss)])`, `error(domain_error(key_type, ss), _)`))
+	t.Run("duplicate", throws(p, `dynamo_schema(users, [attr(x, s), attr(x, n)])`, `error(domain_error(dynamo_schema, attr(x, n)), _)`))
+}
 
+func TestExportImport(t *testing.T) {
+	dir := t.TempDir()
 	p := internal.NewTestProlog()
-	ddb := New(newDB())
+	ddb := NewFromIface(dynamotest.New()).WithFS(DirFS(dir))
 	ddb.Register(p.Interpreter)
+	p.MustExec(t, `:- create_table(users, [key_schema-['UserID'-hash, 'Time'-range], attributes-['UserID'-n, 'Time'-s]]).`)
+	p.MustExec(t, `:- put_item(users, ['UserID'-n(1), 'Time'-s('2001'), msg-s(a), tags-ss([x, y])]).`)
+	p.MustExec(t, `:- put_item(users, ['UserID'-n(2), 'Time'-s('2001'), msg-s(b), data-b('AQI=')]).`)
+	p.MustExec(t, `:- create_table(copy, [key_schema-['UserID'-hash, 'Time'-range], attributes-['UserID'-n, 'Time'-s]]).`)
 
-	sols, err := p.Interpreter.Query("put_item('TestDB', ['UserID'-n(4002), 'Time'-s('2001')]), X = ok.")
+	t.Run("round trip", p.Expect([]map[string]engine.Term{
+		{"Same": engine.Atom("true")},
+	}, `export_table(users, 'users.jsonl'), import_table(copy, 'users.jsonl'),
+		findall(X, scan(users, X), Xs), findall(Y, scan(copy, Y), Ys), (Xs == Ys -> Same = true ; Same = false).`))
+
+	data, err := os.ReadFile(filepath.Join(dir, "users.jsonl"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	for sols.Next() {
-		m := make(map[string]engine.Term)
-		if err := sols.Scan(m); err != nil {
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], `{"Item":{`) {
+		t.Error("bad export:", string(data))
+	}
+
+	t.Run("missing file", throws(p, `import_table(copy, 'nope.jsonl')`, `error(existence_error(source_sink, 'nope.jsonl'), import_table/2)`))
+
+	t.Run("bad line", func(t *testing.T) {
+		_, err := ddb.ImportTable(context.Background(), "copy", strings.NewReader(`{"Item":{"UserID":{"N":"3"},"Time":{"S":"x"}}}`+"\n"+`{"UserID":{"N":"4"}}`))
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Error("expected error for line 2, got:", err)
+		}
+	})
+
+	t.Run("bad file", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(dir, "bad.jsonl"), []byte(`{"Item":{"UserID":{"N":"3"},"Time":{"S":"x"}}}`+"\n"+`{"Item":`), 0644); err != nil {
 			t.Fatal(err)
 		}
-		fmt.Println(m)
+		throws(p, `import_table(copy, 'bad.jsonl')`, `error(syntax_error('line 2: unexpected end of JSON input'), import_table/2)`)(t)
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(dir, "invalid.jsonl"), []byte(`{"Item":{"UserID":{"S":"x"},"Time":{"S":"x"}}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p.MustExec(t, `:- dynamo_schema(copy, [key('UserID', n), sort('Time', s)]).`)
+		throws(p, `import_table(copy, 'invalid.jsonl')`, `error(type_error(n, 'UserID'-s(x)), _)`)(t)
+	})
+
+	t.Run("connection", func(t *testing.T) {
+		other := t.TempDir()
+		p := internal.NewTestProlog()
+		ddb.WithFS(fstest.MapFS{}).WithConnection("backup", ddb.WithFS(DirFS(other))).Register(p.Interpreter)
+		p.MustExec(t, `:- export_table(backup:users, 'users.jsonl').`)
+		if _, err := os.Stat(filepath.Join(other, "users.jsonl")); err != nil {
+			t.Error("export didn't use the connection's file system:", err)
+		}
+		p.MustExec(t, `:- import_table(backup:copy, 'users.jsonl').`)
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		p := internal.NewTestProlog()
+		ddb.WithFS(fstest.MapFS{}).Register(p.Interpreter)
+		throws(p, `export_table(users, 'users.jsonl')`, `error(permission_error(open, source_sink, 'users.jsonl'), export_table/2)`)(t)
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	p := internal.NewTestProlog()
+	ddb := NewFromIface(stall{})
+	ddb.Register(p.Interpreter)
+
+	t.Run("scan", throws(p, `scan(test, [timeout(10)], _)`, `time_limit_exceeded`))
+	t.Run("scan_page", throws(p, `scan_page(test, [timeout(10)], _, _)`, `time_limit_exceeded`))
+	t.Run("query", throws(p, `query(test, 'ID'-s(a), [timeout(10)], _)`, `time_limit_exceeded`))
+	t.Run("put_item", throws(p, `put_item(test, ['ID'-s(a)], [timeout(10)])`, `time_limit_exceeded`))
+	t.Run("delete_item", throws(p, `delete_item(test, 'ID'-s(a), [timeout(10)])`, `time_limit_exceeded`))
+	t.Run("get_item", throws(p, `get_item(test, 'ID'-s(a), [timeout(10)], _)`, `time_limit_exceeded`))
+	t.Run("other predicates", func(t *testing.T) {
+		throws(p, `index_query(test, 'ByName', name-s(a), [timeout(10)], _)`, `time_limit_exceeded`)(t)
+		throws(p, `update_item(test, 'ID'-s(a), [set(x, s(y))], [timeout(10)], _)`, `time_limit_exceeded`)(t)
+		throws(p, `batch_get_item(test, ['ID'-s(a)], [timeout(10)], _)`, `time_limit_exceeded`)(t)
+		throws(p, `batch_write(test, [put(['ID'-s(a)])], [timeout(10)])`, `time_limit_exceeded`)(t)
+		throws(p, `transact([put(test, ['ID'-s(a)])], [timeout(10)])`, `time_limit_exceeded`)(t)
+		throws(p, `transact_get([get(test, 'ID'-s(a))], [timeout(10)], _)`, `time_limit_exceeded`)(t)
+		throws(p, `transact([], [limit(1)])`, `error(domain_error(transact_option, limit(1)), _)`)(t)
+	})
+
+	t.Run("tables", func(t *testing.T) {
+		throws(p, `wait_table(test, active, [timeout(10)])`, `time_limit_exceeded`)(t)
+		throws(p, `describe_table(test, [timeout(10)], _)`, `time_limit_exceeded`)(t)
+		throws(p, `list_tables([timeout(10)], _)`, `time_limit_exceeded`)(t)
+		throws(p, `wait_table(test, active, [limit(1)])`, `error(domain_error(table_option, limit(1)), _)`)(t)
+	})
+
+	t.Run("execute_statement", func(t *testing.T) {
+		throws(p, `execute_statement('SELECT * FROM test', [], [timeout(10)], _)`, `time_limit_exceeded`)(t)
+		throws(p, `execute_statement('SELECT * FROM test', [], [limit(1)], _)`, `error(domain_error(statement_option, limit(1)), _)`)(t)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		for _, query := range []string{"list_tables(_).", "scan(test, _).", "get_item(test, 'ID'-s(a), _)."} {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			sol, err := p.QueryContext(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sol.Next() {
+				t.Error("unexpected solution:", query)
+			}
+			if sol.Err() == nil {
+				t.Error("expected error:", query)
+			}
+			sol.Close()
+			cancel()
+		}
+	})
+}
+
+// stall is a DynamoDB client whose requests block until they are canceled.
+type stall struct {
+	dynamodbiface.DynamoDBAPI
+}
+
+func (stall) wait(ctx aws.Context) error {
+	<-ctx.Done()
+	return awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
+func (s stall) ListTablesWithContext(ctx aws.Context, _ *dynamodb.ListTablesInput, _ ...request.Option) (*dynamodb.ListTablesOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) DescribeTableWithContext(ctx aws.Context, _ *dynamodb.DescribeTableInput, _ ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) UpdateItemWithContext(ctx aws.Context, _ *dynamodb.UpdateItemInput, _ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) BatchGetItemWithContext(ctx aws.Context, _ *dynamodb.BatchGetItemInput, _ ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) BatchWriteItemWithContext(ctx aws.Context, _ *dynamodb.BatchWriteItemInput, _ ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) TransactWriteItemsWithContext(ctx aws.Context, _ *dynamodb.TransactWriteItemsInput, _ ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) TransactGetItemsWithContext(ctx aws.Context, _ *dynamodb.TransactGetItemsInput, _ ...request.Option) (*dynamodb.TransactGetItemsOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) ExecuteStatementWithContext(ctx aws.Context, _ *dynamodb.ExecuteStatementInput, _ ...request.Option) (*dynamodb.ExecuteStatementOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) ScanWithContext(ctx aws.Context, _ *dynamodb.ScanInput, _ ...request.Option) (*dynamodb.ScanOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) QueryWithContext(ctx aws.Context, _ *dynamodb.QueryInput, _ ...request.Option) (*dynamodb.QueryOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) GetItemWithContext(ctx aws.Context, _ *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) PutItemWithContext(ctx aws.Context, _ *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+func (s stall) DeleteItemWithContext(ctx aws.Context, _ *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	return nil, s.wait(ctx)
+}
+
+// recorder is a DynamoDB client that records requests instead of sending them.
+type recorder struct {
+	dynamodbiface.DynamoDBAPI
+	scans  []dynamodb.ScanInput
+	pages  []*dynamodb.ScanOutput
+	writes []*dynamodb.BatchWriteItemInput
+	gets   []*dynamodb.BatchGetItemInput
+	get    *dynamodb.GetItemInput
+	query  *dynamodb.QueryInput
+	desc   *dynamodb.TableDescription
+	descs  int
+	stmts  []dynamodb.ExecuteStatementInput
+	rows   []*dynamodb.ExecuteStatementOutput
+	err    error
+}
+
+func (r *recorder) DescribeTableWithContext(_ aws.Context, input *dynamodb.DescribeTableInput, _ ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	r.descs++
+	if r.desc == nil {
+		// tables are keyed by ID unless the test says otherwise
+		return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{
+			TableName:            input.TableName,
+			KeySchema:            []*dynamodb.KeySchemaElement{{AttributeName: aws.String("ID"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{{AttributeName: aws.String("ID"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}},
+		}}, nil
 	}
-	if err := sols.Err(); err != nil {
-		t.Error(err)
+	return &dynamodb.DescribeTableOutput{Table: r.desc}, nil
+}
+
+func (r *recorder) QueryWithContext(_ aws.Context, input *dynamodb.QueryInput, _ ...request.Option) (*dynamodb.QueryOutput, error) {
+	r.query = input
+	return &dynamodb.QueryOutput{}, r.err
+}
+
+// GetItemWithContext returns the requested key as the item.
+func (r *recorder) GetItemWithContext(_ aws.Context, input *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	r.get = input
+	return &dynamodb.GetItemOutput{Item: input.Key}, r.err
+}
+
+// BatchGetItemWithContext returns the requested items in reverse order, skipping the key 'ID'-s(missing).
+func (r *recorder) BatchGetItemWithContext(_ aws.Context, input *dynamodb.BatchGetItemInput, _ ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	r.gets = append(r.gets, input)
+	output := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{}}
+	for table, req := range input.RequestItems {
+		for i := len(req.Keys) - 1; i >= 0; i-- {
+			if *req.Keys[i]["ID"].S == "missing" {
+				continue
+			}
+			output.Responses[table] = append(output.Responses[table], req.Keys[i])
+		}
 	}
+	return output, r.err
 }
 
-func TestQuery(t *testing.T) {
+func (r *recorder) BatchWriteItemWithContext(_ aws.Context, input *dynamodb.BatchWriteItemInput, _ ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	r.writes = append(r.writes, input)
+	return &dynamodb.BatchWriteItemOutput{}, r.err
+}
+
+func (r *recorder) ScanWithContext(_ aws.Context, input *dynamodb.ScanInput, _ ...request.Option) (*dynamodb.ScanOutput, error) {
+	r.scans = append(r.scans, *input)
+	page := r.pages[0]
+	r.pages = r.pages[1:]
+	return page, r.err
+}
+
+func (r *recorder) ExecuteStatementWithContext(_ aws.Context, input *dynamodb.ExecuteStatementInput, _ ...request.Option) (*dynamodb.ExecuteStatementOutput, error) {
+	r.stmts = append(r.stmts, *input)
+	page := r.rows[0]
+	r.rows = r.rows[1:]
+	return page, r.err
+}
+
+func TestUpdateItem(t *testing.T) {
+	p := newFake(t)
+
+	tests := []struct {
+		name    string
+		updates []string
+		check   string
+	}{
+		{"set", []string{"[set(nickname, s(a))]"}, "member(nickname-s(a), I)"},
+		{"add", []string{"[add(pageviews, 1)]", "[add(pageviews, 2)]"}, "member(pageviews-n('3'), I)"},
+		{"remove", []string{"[remove(msg)]"}, `\+ member(msg-_, I)`},
+		{"delete", []string{"[set(tags, ss([a, b]))]", "[delete(tags, ss([a]))]"}, "member(tags-ss([s(b)]), I)"},
+		{"reserved word", []string{"[add('Count', 1)]"}, "member('Count'-n('1'), I)"},
+		{"odd names", []string{"[set('a.b', s(c)), set('my tags', ss([x, y]))]", "[set('first-name', s(a)), remove('a.b'), delete('my tags', x)]"},
+			`member('first-name'-s(a), I), \+ member('a.b'-_, I), member('my tags'-ss([s(y)]), I)`},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key := "key(10, '" + strconv.Itoa(i) + "')"
+			p.MustExec(t, ":- put_item(users, ['UserID'-n(10), 'Time'-s('"+strconv.Itoa(i)+"'), msg-s(x)]).")
+			for _, actions := range test.updates {
+				p.MustExec(t, ":- update_item(users, "+key+", "+actions+").")
+			}
+			p.MustExec(t, ":- get_item(users, "+key+", I), "+test.check+".")
+		})
+	}
+
+	t.Run("creates item", func(t *testing.T) {
+		p.MustExec(t, `:- update_item(users, key(11, '2001'), [set(msg, s(new))], new(I)), I == ['Time'-s('2001'), 'UserID'-n('11'), msg-s(new)].`)
+	})
+
+	t.Run("returning new item", func(t *testing.T) {
+		p.MustExec(t, `:- update_item(users, key(1, '2001'), [add('Count', 1)], new(I)), member('Count'-n('1'), I), member(msg-s(a), I).`)
+	})
+
+	t.Run("returning old item", func(t *testing.T) {
+		p.MustExec(t, `:- update_item(users, key(1, '2001'), [add('Count', 1)], old(I)), member('Count'-n('1'), I).`)
+		p.MustExec(t, `:- get_item(users, key(1, '2001'), I), member('Count'-n('2'), I).`)
+	})
+
+	t.Run("delete element", func(t *testing.T) {
+		p.MustExec(t, `:- update_item(users, key(1, '2002'), [set(tags, ss([a, b]))]).`)
+		p.MustExec(t, `:- update_item(users, key(1, '2002'), [delete(tags, a)], new(I)), member(tags-ss([s(b)]), I).`)
+	})
+
+	t.Run("key attribute", throws(p, `update_item(users, key(1, '2001'), [set('Time', s('2003'))])`, `error(dynamodb_error(validation, _), _)`))
+	t.Run("bad action", throws(p, `update_item(users, key(1, '2001'), [frob(x)])`, `error(domain_error(update_action, frob(x)), _)`))
+}
+
+func TestPutItemCondition(t *testing.T) {
+	p := newFake(t)
+
+	t.Run("condition holds", func(t *testing.T) {
+		p.MustExec(t, `:- put_item(users, ['UserID'-n(1), 'Time'-s('2001'), msg-s(a2)], [if(msg = s(a))]).`)
+		p.MustExec(t, `:- get_item(users, key(1, '2001'), I), member(msg-s(a2), I).`)
+	})
+
+	t.Run("several conditions", func(t *testing.T) {
+		p.MustExec(t, `:- put_item(users, ['UserID'-n(1), 'Time'-s('2002'), msg-s(b2)], [if(msg = s(b)), if(attribute_exists('Time'))]).`)
+		p.MustExec(t, `:- \+ put_item(users, ['UserID'-n(1), 'Time'-s('2002'), msg-s(b3)], [if(msg = s(b2)), if(msg = s(other))]).`)
+		p.MustExec(t, `:- get_item(users, key(1, '2002'), I), member(msg-s(b2), I).`)
+	})
+
+	t.Run("condition failed", func(t *testing.T) {
+		p.MustExec(t, `:- \+ put_item(users, ['UserID'-n(2), 'Time'-s('2001')], [if(attribute_not_exists('UserID'))]).`)
+		p.MustExec(t, `:- get_item(users, key(2, '2001'), I), member(msg-s(c), I).`)
+	})
+
+	t.Run("condition failed error", throws(p, `put_item(users, ['UserID'-n(2), 'Time'-s('2001')], [if(attribute_not_exists('UserID')), if_failed(error)])`,
+		`error(dynamodb_error(conditional_check_failed, _), _)`))
+
+	t.Run("delete_item", func(t *testing.T) {
+		p.MustExec(t, `:- \+ delete_item(users, key(2, '2001'), [if(msg = s(other))]).`)
+		p.MustExec(t, `:- delete_item(users, key(2, '2001'), [if(msg = s(c))]).`)
+		p.MustExec(t, `:- \+ get_item(users, key(2, '2001'), _).`)
+	})
+}
+
+func TestScanWithOptions(t *testing.T) {
+	p := internal.NewTestProlog()
+	rec := new(recorder)
+	ddb := NewFromIface(rec)
+	ddb.Register(p.Interpreter)
+
+	item := func(id string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"ID": {S: aws.String(id)}}
+	}
+	rec.pages = []*dynamodb.ScanOutput{
+		{Items: []map[string]*dynamodb.AttributeValue{item("a"), item("b")}, LastEvaluatedKey: item("b")},
+		{Items: []map[string]*dynamodb.AttributeValue{item("c")}},
+	}
+
+	t.Run("paginates", p.Expect([]map[string]engine.Term{
+		{"ID": engine.Atom("a")},
+		{"ID": engine.Atom("b")},
+		{"ID": engine.Atom("c")},
+	}, "scan(test, [filter(attribute_exists('ID')), project(['ID']), segment(1, 4)], ['ID'-s(ID)])."))
+
+	if len(rec.scans) != 2 {
+		t.Fatal("want 2 requests, got:", len(rec.scans))
+	}
+	input := rec.scans[0]
+	if got := *input.FilterExpression; got != "(attribute_exists(#n0))" {
+		t.Error("bad filter:", got)
+	}
+	if got := *input.ProjectionExpression; got != "#n0" {
+		t.Error("bad projection:", got)
+	}
+	if *input.Segment != 1 || *input.TotalSegments != 4 {
+		t.Error("bad segment:", *input.Segment, *input.TotalSegments)
+	}
+	if rec.scans[1].ExclusiveStartKey == nil {
+		t.Error("missing start key for second page")
+	}
+
+	t.Run("bad segment", throws(p, `scan(test, [segment(4, 4)], _)`, `error(domain_error(segment, segment(4, 4)), _)`))
+
+	t.Run("filter and projection", func(t *testing.T) {
+		p := newFake(t)
+		p.MustExec(t, `:- findall(I, scan(users, [filter(and('UserID' = n(1), begins_with(msg, s(b)))), project(['Time', msg])], I), Items),
+			Items == [['Time'-s('2002'), msg-s(b)]].`)
+		p.MustExec(t, `:- findall(U-T, scan(users, [filter(msg \= s(a)), project(['UserID', 'Time'])], ['Time'-s(T), 'UserID'-n(U)]), Found),
+			sort(Found, Sorted), Sorted == ['1'-'2002', '2'-'2001'].`)
+		p.MustExec(t, `:- findall(T, query(users, 'UserID'-n(1)-&-('Time' > s('2001')), ['Time'-s(T)|_]), Ts), Ts == ['2002'].`)
+	})
+}
+
+func TestBatch(t *testing.T) {
+	p := internal.NewTestProlog()
+	rec := new(recorder)
+	ddb := NewFromIface(rec)
+	ddb.Register(p.Interpreter)
+
+	item := func(id string) engine.Term {
+		return engine.List(engine.Atom("-").Apply(engine.Atom("ID"), engine.Atom("s").Apply(engine.Atom(id))))
+	}
+	t.Run("batch_get_item keeps order", p.Expect([]map[string]engine.Term{
+		{"Items": engine.List(item("a"), engine.Atom("[]"), item("b"), item("c"))},
+	}, "batch_get_item(test, ['ID'-s(a), 'ID'-s(missing), 'ID'-s(b), 'ID'-s(c)], Items)."))
+
+	t.Run("batch_get_item duplicate keys", func(t *testing.T) {
+		p.MustExec(t, `:- batch_get_item(test, ['ID'-s(a), 'ID'-s(b), 'ID'-s(a)], [A, B, A]), A \== [], B \== [].`)
+		if n := len(rec.gets[len(rec.gets)-1].RequestItems["test"].Keys); n != 2 {
+			t.Error("want 2 keys, got:", n)
+		}
+	})
+
+	t.Run("batch_get_item mixed keys", throws(p, `batch_get_item(test, ['ID'-s(a), 'Other'-s(b)], _)`, `error(domain_error(key_schema(['ID'-s]), 'Other'-s(b)), _)`))
+
+	t.Run("batch_write chunks", func(t *testing.T) {
+		p.Expect(okay, "findall(put(['ID'-n(X)]), between(1, 30, X), Puts), batch_write(test, [delete('ID'-s(x))|Puts]), OK = true.")(t)
+		if len(rec.writes) != 2 {
+			t.Fatal("want 2 requests, got:", len(rec.writes))
+		}
+		if n := len(rec.writes[0].RequestItems["test"]); n != 25 {
+			t.Error("want 25 operations in first request, got:", n)
+		}
+	})
+}
+
+func TestFakeBatchGet(t *testing.T) {
+	p := newFake(t)
+	msg := func(m string) engine.Term {
+		return engine.List(
+			pair("Time", engine.Atom("s").Apply(engine.Atom("2002"))),
+			pair("UserID", engine.Atom("n").Apply(engine.Atom("1"))),
+			pair("msg", engine.Atom("s").Apply(engine.Atom(m))),
+		)
+	}
+	t.Run("batch_get_item", p.Expect([]map[string]engine.Term{
+		{"Items": engine.List(msg("b"), engine.Atom("[]"))},
+	}, "batch_get_item(users, [key(1, '2002'), key(3, '2001')], Items)."))
+
+	t.Run("normalized numbers", func(t *testing.T) {
+		p.MustExec(t, `:- batch_get_item(users, [key(1, '2002'), key(n('1.0'), '2002'), key(n('01'), '2002')], [I, I, I]), I \== [].`)
+	})
+}
+
+func TestFakeUnsupported(t *testing.T) {
+	p := newFake(t)
+	for _, query := range []string{
+		"execute_statement('SELECT * FROM users', [], _).",
+	} {
+		t.Run(query, func(t *testing.T) {
+			sol, err := p.Query(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sol.Close()
+			if sol.Next() {
+				t.Error("unexpected solution")
+			}
+			if sol.Err() == nil {
+				t.Error("want error")
+			}
+		})
+	}
+}
+
+func TestExecuteStatement(t *testing.T) {
+	p := internal.NewTestProlog()
+	rec := new(recorder)
+	ddb := NewFromIface(rec)
+	ddb.Register(p.Interpreter)
+
+	row := func(id string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"ID": {S: aws.String(id)}}
+	}
+
+	t.Run("select", func(t *testing.T) {
+		rec.stmts = nil
+		rec.rows = []*dynamodb.ExecuteStatementOutput{
+			{Items: []map[string]*dynamodb.AttributeValue{row("a"), row("b")}, NextToken: aws.String("next")},
+			{Items: []map[string]*dynamodb.AttributeValue{row("c")}},
+		}
+		p.Expect([]map[string]engine.Term{
+			{"ID": engine.Atom("a")},
+			{"ID": engine.Atom("b")},
+			{"ID": engine.Atom("c")},
+		}, `execute_statement('SELECT * FROM test WHERE Kind = ? AND N > ?', [s(x), 42], Item), member('ID'-s(ID), Item).`)(t)
+
+		if len(rec.stmts) != 2 {
+			t.Fatal("want 2 requests, got:", len(rec.stmts))
+		}
+		if got := rec.stmts[0].Parameters; len(got) != 2 || aws.StringValue(got[0].S) != "x" || aws.StringValue(got[1].N) != "42" {
+			t.Error("bad parameters:", got)
+		}
+		if got := aws.StringValue(rec.stmts[1].NextToken); got != "next" {
+			t.Error("bad next token:", got)
+		}
+	})
+
+	t.Run("select nothing", func(t *testing.T) {
+		rec.rows = []*dynamodb.ExecuteStatementOutput{{}}
+		p.Expect(fail, `execute_statement('SELECT * FROM test', [], _).`)(t)
+	})
+
+	t.Run("insert", func(t *testing.T) {
+		rec.rows = []*dynamodb.ExecuteStatementOutput{{}}
+		p.Expect([]map[string]engine.Term{
+			{"Item": engine.Atom("[]")},
+		}, `execute_statement('INSERT INTO test VALUE {''ID'': ?}', [s(a)], Item).`)(t)
+	})
+}
+
+func TestTransact(t *testing.T) {
+	p := newFake(t)
+
+	t.Run("ok", func(t *testing.T) {
+		p.MustExec(t, `:- transact([
+			put(users, ['UserID'-n(3), 'Time'-s('2001'), msg-s(d)]),
+			update(users, key(1, '2001'), [add(hits, 1)]),
+			delete(users, key(1, '2002')),
+			check(users, key(2, '2001'), attribute_exists(msg))
+		]).`)
+		p.MustExec(t, `:- get_item(users, key(3, '2001'), I), member(msg-s(d), I).`)
+		p.MustExec(t, `:- get_item(users, key(1, '2001'), I), member(hits-n('1'), I).`)
+		p.MustExec(t, `:- \+ get_item(users, key(1, '2002'), _).`)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		p.MustExec(t, `:- catch(
+			(transact([
+				put(users, ['UserID'-n(4), 'Time'-s('2001')]),
+				update(users, key(1, '2001'), [add(hits, 1)]),
+				check(users, key(2, '2001'), attribute_not_exists(msg))
+			]), Thrown = no),
+			error(dynamodb_error(transaction_canceled, Reasons), _),
+			Thrown = yes
+		), Thrown == yes, Reasons = [reason(N, check(_, _, _), Code, _)], N == 3, Code == conditional_check_failed.`)
+		// nothing was written
+		p.MustExec(t, `:- \+ get_item(users, key(4, '2001'), _).`)
+		p.MustExec(t, `:- get_item(users, key(1, '2001'), I), member(hits-n('1'), I).`)
+	})
+
+	t.Run("transact_get", func(t *testing.T) {
+		p.MustExec(t, `:- transact_get([get(users, key(3, '2001')), get(users, key(9, '2001'))], [A, B]),
+			A == ['Time'-s('2001'), 'UserID'-n('3'), msg-s(d)], B == [].`)
+	})
+}
+
+func TestKeySchema(t *testing.T) {
+	p := internal.NewTestProlog()
+	rec := &recorder{
+		desc: &dynamodb.TableDescription{
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{AttributeName: aws.String("UserID"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+				{AttributeName: aws.String("Time"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+			},
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{AttributeName: aws.String("UserID"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)},
+				{AttributeName: aws.String("Time"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			},
+		},
+	}
+	ddb := NewFromIface(rec)
+	ddb.Register(p.Interpreter)
+
+	want := []map[string]engine.Term{
+		{"Item": engine.List(
+			engine.Atom("-").Apply(engine.Atom("Time"), engine.Atom("s").Apply(engine.Atom("2001"))),
+			engine.Atom("-").Apply(engine.Atom("UserID"), engine.Atom("n").Apply(engine.Atom("42"))),
+		)},
+	}
+	t.Run("list", p.Expect(want, "get_item(users, ['UserID'-42, 'Time'-'2001'], Item)."))
+	t.Run("positional", p.Expect(want, "get_item(users, key(42, '2001'), Item)."))
+	t.Run("pairs", p.Expect(want, "get_item(users, 'UserID'-'42'-&-'Time'-2001, Item)."))
+	t.Run("typed", p.Expect(want, "get_item(users, 'UserID'-n(42)-&-'Time'-s('2001'), Item)."))
+	if rec.descs != 1 {
+		t.Error("want 1 DescribeTable request, got:", rec.descs)
+	}
+
+	t.Run("query", func(t *testing.T) {
+		p.Expect(fail, "query(users, 'UserID'-42-&-'Time'-begins_with(2001), _).")(t)
+		conds := rec.query.KeyConditions
+		if got := aws.StringValue(conds["UserID"].AttributeValueList[0].N); got != "42" {
+			t.Error("bad partition key. want: 42 got:", got)
+		}
+		if got := aws.StringValue(conds["Time"].AttributeValueList[0].S); got != "2001" {
+			t.Error("bad sort key. want: 2001 got:", got)
+		}
+	})
 
+	schemaError := func(culprit string) string {
+		return "error(domain_error(key_schema(['UserID'-n, 'Time'-s]), " + culprit + "), _)"
+	}
+	t.Run("wrong name", throws(p, `get_item(users, ['UserID'-42, 'Date'-x], _)`, schemaError(`['UserID'-42, 'Date'-x]`)))
+	t.Run("missing sort key", throws(p, `get_item(users, key(42), _)`, schemaError(`key(42)`)))
+	t.Run("wrong type", throws(p, `get_item(users, key(abc, x), _)`, schemaError(`abc`)))
+	t.Run("wrong typed value", throws(p, `get_item(users, key(s(abc), x), _)`, schemaError(`s(abc)`)))
+	t.Run("typed keys", func(t *testing.T) {
+		throws(p, `get_item(users, 'UserID'-n(42)-&-'Date'-s(x), _)`, schemaError(`'UserID'-n(42)-&-'Date'-s(x)`))(t)
+		throws(p, `get_item(users, 'ID'-n(42)-&-'Time'-s(x), _)`, schemaError(`'ID'-n(42)-&-'Time'-s(x)`))(t)
+		throws(p, `get_item(users, 'UserID'-n(42), _)`, schemaError(`'UserID'-n(42)`))(t)
+		throws(p, `get_item(users, 'UserID'-s(abc)-&-'Time'-s(x), _)`, schemaError(`s(abc)`))(t)
+		throws(p, `delete_item(users, 'ID'-n(42)-&-'Time'-s(x))`, schemaError(`'ID'-n(42)-&-'Time'-s(x)`))(t)
+		throws(p, `update_item(users, 'ID'-n(42)-&-'Time'-s(x), [set(a, s(b))])`, schemaError(`'ID'-n(42)-&-'Time'-s(x)`))(t)
+		throws(p, `query(users, 'ID'-n(42), _)`, schemaError(`'ID'-n(42)`))(t)
+		throws(p, `query(users, 'UserID'-n(42)-&-'Date'-begins_with(s(x)), _)`, schemaError(`'UserID'-n(42)-&-'Date'-begins_with(s(x))`))(t)
+	})
 }
 
 func TestAttributeValue(t *testing.T) {
 	p := internal.NewTestProlog()
-	ddb := New(newDB())
+	ddb := NewFromIface(dynamotest.New())
 	ddb.Register(p.Interpreter)
 
 	t.Run("value is variable", func(t *testing.T) {
@@ -102,8 +1176,22 @@ func TestAttributeValue(t *testing.T) {
 		}, "attribute_value(n('42'), V)."))
 
 		t.Run("number atom float", p.Expect([]map[string]engine.Term{
-			{"V": engine.Float(42)},
-		}, "attribute_value(n('42.0'), V)."))
+			{"V": engine.Float(42.5)},
+		}, "attribute_value(n('42.5'), V)."))
+
+		t.Run("number atom integral", p.Expect([]map[string]engine.Term{
+			{"V": engine.Integer(42)},
+		}, "attribute_value(n('42.0'), V), attribute_value(n('4.2e1'), V)."))
+
+		t.Run("number big integer", p.Expect([]map[string]engine.Term{
+			{"V": engine.Atom("n").Apply(engine.Atom("12345678901234567890"))},
+		}, "attribute_value(n('12345678901234567890'), V)."))
+
+		t.Run("number precise decimal", p.Expect([]map[string]engine.Term{
+			{"V": engine.Atom("n").Apply(engine.Atom("0.12345678901234567890123"))},
+		}, "attribute_value(n('0.12345678901234567890123'), V)."))
+
+		t.Run("number invalid", throws(p, `attribute_value(n(abc), _)`, `error(domain_error(number, abc), _)`))
 
 		t.Run("string", p.Expect([]map[string]engine.Term{
 			{"V": engine.Atom("foo")},
@@ -119,6 +1207,18 @@ func TestAttributeValue(t *testing.T) {
 		t.Run("list", p.Expect([]map[string]engine.Term{
 			{"V": engine.List(engine.Integer(1), engine.Integer(2), engine.Integer(3))},
 		}, "attribute_value(l([n(1), n(2), n(3)]), V)."))
+
+		t.Run("string set", p.Expect([]map[string]engine.Term{
+			{"V": engine.Atom("set").Apply(engine.List(engine.Atom("a"), engine.Atom("b")))},
+		}, "attribute_value(ss([s(b), s(a)]), V)."))
+
+		t.Run("number set", p.Expect([]map[string]engine.Term{
+			{"V": engine.Atom("set").Apply(engine.List(engine.Float(0.5), engine.Integer(2), engine.Integer(10)))},
+		}, "attribute_value(ns([n('10'), n('0.5'), n('2')]), V)."))
+
+		t.Run("binary set", p.Expect([]map[string]engine.Term{
+			{"V": engine.Atom("set").Apply(engine.List(engine.Atom("b").Apply(engine.Atom("AQI=")), engine.Atom("b").Apply(engine.Atom("Ag=="))))},
+		}, "attribute_value(bs([b('Ag=='), b('AQI=')]), V)."))
 	})
 
 	t.Run("attr is variable", func(t *testing.T) {
@@ -136,8 +1236,26 @@ func TestAttributeValue(t *testing.T) {
 				engine.Atom("n").Apply(engine.Atom("3")),
 			))},
 		}, "attribute_value(V, [1, 2, 3])."))
+
+		t.Run("string set", p.Expect([]map[string]engine.Term{
+			{"V": engine.Atom("ss").Apply(engine.List(engine.Atom("s").Apply(engine.Atom("a")), engine.Atom("s").Apply(engine.Atom("b"))))},
+		}, "attribute_value(V, set([a, b]))."))
+
+		t.Run("number set", p.Expect([]map[string]engine.Term{
+			{"V": engine.Atom("ns").Apply(engine.List(engine.Atom("n").Apply(engine.Atom("1")), engine.Atom("n").Apply(engine.Atom("2.5"))))},
+		}, "attribute_value(V, set([1, 2.5]))."))
+
+		t.Run("binary set", p.Expect([]map[string]engine.Term{
+			{"V": engine.Atom("bs").Apply(engine.List(engine.Atom("b").Apply(engine.Atom("AQI="))))},
+		}, "attribute_value(V, set([b('AQI=')]))."))
+
+		t.Run("empty set", throws(p, `attribute_value(_, set([]))`, `error(domain_error(non_empty_list, []), _)`))
 	})
 
+	t.Run("float", p.Expect([]map[string]engine.Term{
+		{"V": engine.Atom("n").Apply(engine.Atom("0.1"))},
+	}, "attribute_value(V, 0.1)."))
+
 	t.Run("both ground and equal", p.Expect(okay, "attribute_value(n(1), 1), attribute_value(n('1'), 1), OK = true."))
 
 	t.Run("both ground and not equal", p.Expect(fail, "attribute_value(n(1), 2), OK = true."))
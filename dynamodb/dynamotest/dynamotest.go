@@ -0,0 +1,1217 @@
+// Package dynamotest provides an in-memory fake of DynamoDB for tests.
+//
+// It supports creating, describing, listing, and deleting tables, and
+// putting, getting, deleting, batch getting, batch writing, querying, and scanning items according to the tables' key schemas.
+// Queries and scans of secondary indexes only return the attributes projected into the index.
+// Updates, transactions, and condition, filter, key condition, and projection expressions are supported,
+// including document paths and every function, but not the legacy parameters they replaced
+// (such as Expected, AttributeUpdates, QueryFilter, and AttributesToGet), nor PartiQL statements.
+//
+// Tables created with a stream specification record their changes,
+// which can be read with the DynamoDB Streams client returned by DB.Streams.
+//
+// Time to live can be enabled, but expired items are never deleted.
+//
+// Requests that set ReturnConsumedCapacity get a simplified estimate that ignores item size:
+// 1 unit per item written, and 0.5 units per item read (1 if consistent), at least one item's worth per request.
+package dynamotest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DB is an in-memory DynamoDB client.
+// PartiQL statements and legacy parameters return ErrUnsupported. Other methods that aren't implemented panic.
+type DB struct {
+	dynamodbiface.DynamoDBAPI
+
+	mu      sync.Mutex
+	tables  map[string]*table
+	streams map[string]*stream
+}
+
+var _ dynamodbiface.DynamoDBAPI = (*DB)(nil)
+
+// New returns an empty DB.
+func New() *DB {
+	return &DB{
+		tables:  make(map[string]*table),
+		streams: make(map[string]*stream),
+	}
+}
+
+type item = map[string]*dynamodb.AttributeValue
+
+type table struct {
+	desc   *dynamodb.TableDescription
+	items  map[string]item
+	stream *stream
+	// TTL attribute, "" if disabled
+	ttl string
+}
+
+// ErrUnsupported is returned for requests using features this fake doesn't support.
+var ErrUnsupported = errors.New("dynamotest: unsupported")
+
+func unsupported(what string) error {
+	return fmt.Errorf("%w: %s", ErrUnsupported, what)
+}
+
+func validationError(format string, args ...interface{}) error {
+	return awserr.New("ValidationException", fmt.Sprintf(format, args...), nil)
+}
+
+func conditionFailed() error {
+	return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+}
+
+func notFound() error {
+	return awserr.New(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found", nil)
+}
+
+// consumed returns the capacity consumed by a request for n items if it asked for it with mode, otherwise nil.
+func consumed(mode *string, table string, n int, unit float64) *dynamodb.ConsumedCapacity {
+	switch aws.StringValue(mode) {
+	case "", dynamodb.ReturnConsumedCapacityNone:
+		return nil
+	}
+	if n == 0 {
+		n = 1
+	}
+	return &dynamodb.ConsumedCapacity{
+		TableName:     aws.String(table),
+		CapacityUnits: aws.Float64(float64(n) * unit),
+	}
+}
+
+// readUnit returns the capacity consumed by reading an item.
+func readUnit(consistent *bool) float64 {
+	if aws.BoolValue(consistent) {
+		return 1
+	}
+	return 0.5
+}
+
+func (db *DB) table(name *string) (*table, error) {
+	t, ok := db.tables[aws.StringValue(name)]
+	if !ok {
+		return nil, notFound()
+	}
+	return t, nil
+}
+
+func (db *DB) CreateTableWithContext(_ aws.Context, input *dynamodb.CreateTableInput, _ ...request.Option) (*dynamodb.CreateTableOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	name := aws.StringValue(input.TableName)
+	if _, ok := db.tables[name]; ok {
+		return nil, awserr.New(dynamodb.ErrCodeResourceInUseException, "Table already exists: "+name, nil)
+	}
+
+	desc := &dynamodb.TableDescription{
+		TableName:            input.TableName,
+		TableArn:             aws.String("arn:aws:dynamodb:local:000000000000:table/" + name),
+		TableStatus:          aws.String(dynamodb.TableStatusActive),
+		CreationDateTime:     aws.Time(time.Now()),
+		KeySchema:            input.KeySchema,
+		AttributeDefinitions: input.AttributeDefinitions,
+		BillingModeSummary: &dynamodb.BillingModeSummary{
+			BillingMode: aws.String(dynamodb.BillingModeProvisioned),
+		},
+		ProvisionedThroughput: throughput(input.ProvisionedThroughput),
+	}
+	if aws.StringValue(input.BillingMode) == dynamodb.BillingModePayPerRequest {
+		desc.BillingModeSummary.BillingMode = input.BillingMode
+	}
+	for _, gsi := range input.GlobalSecondaryIndexes {
+		desc.GlobalSecondaryIndexes = append(desc.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndexDescription{
+			IndexName:             gsi.IndexName,
+			IndexArn:              aws.String(aws.StringValue(desc.TableArn) + "/index/" + aws.StringValue(gsi.IndexName)),
+			KeySchema:             gsi.KeySchema,
+			Projection:            gsi.Projection,
+			IndexStatus:           aws.String(dynamodb.IndexStatusActive),
+			ProvisionedThroughput: throughput(gsi.ProvisionedThroughput),
+		})
+	}
+	for _, lsi := range input.LocalSecondaryIndexes {
+		desc.LocalSecondaryIndexes = append(desc.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndexDescription{
+			IndexName:  lsi.IndexName,
+			IndexArn:   aws.String(aws.StringValue(desc.TableArn) + "/index/" + aws.StringValue(lsi.IndexName)),
+			KeySchema:  lsi.KeySchema,
+			Projection: lsi.Projection,
+		})
+	}
+
+	t := &table{
+		desc:  desc,
+		items: make(map[string]item),
+	}
+	if _, _, err := t.schema(""); err != nil {
+		return nil, err
+	}
+	db.enableStream(t, input.StreamSpecification)
+	db.tables[name] = t
+	return &dynamodb.CreateTableOutput{TableDescription: t.describe()}, nil
+}
+
+func throughput(tp *dynamodb.ProvisionedThroughput) *dynamodb.ProvisionedThroughputDescription {
+	if tp == nil {
+		return &dynamodb.ProvisionedThroughputDescription{
+			ReadCapacityUnits:  aws.Int64(0),
+			WriteCapacityUnits: aws.Int64(0),
+		}
+	}
+	return &dynamodb.ProvisionedThroughputDescription{
+		ReadCapacityUnits:  tp.ReadCapacityUnits,
+		WriteCapacityUnits: tp.WriteCapacityUnits,
+	}
+}
+
+func (db *DB) DescribeTableWithContext(_ aws.Context, input *dynamodb.DescribeTableInput, _ ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.DescribeTableOutput{Table: t.describe()}, nil
+}
+
+func (db *DB) DeleteTableWithContext(_ aws.Context, input *dynamodb.DeleteTableInput, _ ...request.Option) (*dynamodb.DeleteTableOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	delete(db.tables, aws.StringValue(input.TableName))
+	desc := t.describe()
+	desc.TableStatus = aws.String(dynamodb.TableStatusDeleting)
+	return &dynamodb.DeleteTableOutput{TableDescription: desc}, nil
+}
+
+func (db *DB) ListTablesWithContext(_ aws.Context, input *dynamodb.ListTablesInput, _ ...request.Option) (*dynamodb.ListTablesOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		if name > aws.StringValue(input.ExclusiveStartTableName) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	output := &dynamodb.ListTablesOutput{}
+	if limit := int(aws.Int64Value(input.Limit)); limit > 0 && len(names) > limit {
+		names = names[:limit]
+		output.LastEvaluatedTableName = aws.String(names[limit-1])
+	}
+	output.TableNames = aws.StringSlice(names)
+	return output, nil
+}
+
+func (db *DB) UpdateTimeToLiveWithContext(_ aws.Context, input *dynamodb.UpdateTimeToLiveInput, _ ...request.Option) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	spec := input.TimeToLiveSpecification
+	switch {
+	case *spec.Enabled && t.ttl != "":
+		return nil, validationError("TimeToLive is already enabled")
+	case !*spec.Enabled && t.ttl == "":
+		return nil, validationError("TimeToLive is already disabled")
+	case *spec.Enabled:
+		t.ttl = *spec.AttributeName
+	default:
+		t.ttl = ""
+	}
+	return &dynamodb.UpdateTimeToLiveOutput{TimeToLiveSpecification: spec}, nil
+}
+
+func (db *DB) DescribeTimeToLiveWithContext(_ aws.Context, input *dynamodb.DescribeTimeToLiveInput, _ ...request.Option) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	desc := &dynamodb.TimeToLiveDescription{
+		TimeToLiveStatus: aws.String(dynamodb.TimeToLiveStatusDisabled),
+	}
+	if t.ttl != "" {
+		desc.TimeToLiveStatus = aws.String(dynamodb.TimeToLiveStatusEnabled)
+		desc.AttributeName = aws.String(t.ttl)
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: desc}, nil
+}
+
+func (db *DB) PutItemWithContext(_ aws.Context, input *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	if input.Expected != nil {
+		return nil, unsupported("Expected")
+	}
+	ph := newPlaceholders(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	cond, err := ph.condition(input.ConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err := ph.done(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.key(input.Item, false)
+	if err != nil {
+		return nil, err
+	}
+	old := t.items[key]
+	if !cond(old) {
+		return nil, conditionFailed()
+	}
+	t.items[key] = clone(input.Item)
+	t.record(old, input.Item)
+
+	output := &dynamodb.PutItemOutput{
+		ConsumedCapacity: consumed(input.ReturnConsumedCapacity, *input.TableName, 1, 1),
+	}
+	if aws.StringValue(input.ReturnValues) == dynamodb.ReturnValueAllOld {
+		output.Attributes = old
+	}
+	return output, nil
+}
+
+func (db *DB) GetItemWithContext(_ aws.Context, input *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	if input.AttributesToGet != nil {
+		return nil, unsupported("AttributesToGet")
+	}
+	ph := newPlaceholders(input.ExpressionAttributeNames, nil)
+	proj, err := ph.projection(input.ProjectionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err := ph.done(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.key(input.Key, true)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{
+		Item:             project(t.items[key], proj),
+		ConsumedCapacity: consumed(input.ReturnConsumedCapacity, *input.TableName, 1, readUnit(input.ConsistentRead)),
+	}, nil
+}
+
+func (db *DB) DeleteItemWithContext(_ aws.Context, input *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	if input.Expected != nil {
+		return nil, unsupported("Expected")
+	}
+	ph := newPlaceholders(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	cond, err := ph.condition(input.ConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err := ph.done(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.key(input.Key, true)
+	if err != nil {
+		return nil, err
+	}
+	old := t.items[key]
+	if !cond(old) {
+		return nil, conditionFailed()
+	}
+	delete(t.items, key)
+	t.record(old, nil)
+
+	output := &dynamodb.DeleteItemOutput{
+		ConsumedCapacity: consumed(input.ReturnConsumedCapacity, *input.TableName, 1, 1),
+	}
+	if aws.StringValue(input.ReturnValues) == dynamodb.ReturnValueAllOld {
+		output.Attributes = old
+	}
+	return output, nil
+}
+
+// BatchWriteItemWithContext puts and deletes items. Every request is processed, so there are never unprocessed items.
+func (db *DB) BatchWriteItemWithContext(_ aws.Context, input *dynamodb.BatchWriteItemInput, _ ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	type write struct {
+		t    *table
+		key  string
+		item item
+	}
+	var writes []write
+	for name, reqs := range input.RequestItems {
+		t, err := db.table(aws.String(name))
+		if err != nil {
+			return nil, err
+		}
+		for _, req := range reqs {
+			var w write
+			switch {
+			case req.PutRequest != nil:
+				w.item = req.PutRequest.Item
+				w.key, err = t.key(w.item, false)
+			case req.DeleteRequest != nil:
+				w.key, err = t.key(req.DeleteRequest.Key, true)
+			default:
+				err = validationError("empty write request")
+			}
+			if err != nil {
+				return nil, err
+			}
+			w.t = t
+			writes = append(writes, w)
+		}
+	}
+
+	for _, w := range writes {
+		old := w.t.items[w.key]
+		if w.item == nil {
+			delete(w.t.items, w.key)
+		} else {
+			w.t.items[w.key] = clone(w.item)
+		}
+		w.t.record(old, w.item)
+	}
+
+	output := &dynamodb.BatchWriteItemOutput{}
+	for name, reqs := range input.RequestItems {
+		if cc := consumed(input.ReturnConsumedCapacity, name, len(reqs), 1); cc != nil {
+			output.ConsumedCapacity = append(output.ConsumedCapacity, cc)
+		}
+	}
+	return output, nil
+}
+
+// BatchGetItemWithContext gets items from several tables. Every key is processed, so there are never unprocessed keys.
+func (db *DB) BatchGetItemWithContext(_ aws.Context, input *dynamodb.BatchGetItemInput, _ ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	output := &dynamodb.BatchGetItemOutput{
+		Responses: make(map[string][]map[string]*dynamodb.AttributeValue),
+	}
+	for name, keys := range input.RequestItems {
+		if keys.AttributesToGet != nil {
+			return nil, unsupported("AttributesToGet")
+		}
+		ph := newPlaceholders(keys.ExpressionAttributeNames, nil)
+		proj, err := ph.projection(keys.ProjectionExpression)
+		if err != nil {
+			return nil, err
+		}
+		if err := ph.done(); err != nil {
+			return nil, err
+		}
+		t, err := db.table(aws.String(name))
+		if err != nil {
+			return nil, err
+		}
+		items := []item{}
+		for _, k := range keys.Keys {
+			key, err := t.key(k, true)
+			if err != nil {
+				return nil, err
+			}
+			if it, ok := t.items[key]; ok {
+				items = append(items, project(it, proj))
+			}
+		}
+		output.Responses[name] = items
+		if cc := consumed(input.ReturnConsumedCapacity, name, len(keys.Keys), readUnit(keys.ConsistentRead)); cc != nil {
+			output.ConsumedCapacity = append(output.ConsumedCapacity, cc)
+		}
+	}
+	return output, nil
+}
+
+// UpdateItemWithContext updates an item with an update expression, creating it if it doesn't exist.
+func (db *DB) UpdateItemWithContext(_ aws.Context, input *dynamodb.UpdateItemInput, _ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	if input.Expected != nil || input.AttributeUpdates != nil {
+		return nil, unsupported("Expected and AttributeUpdates")
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	ph := newPlaceholders(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	cond, err := ph.condition(input.ConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+	upd, err := ph.update(input.UpdateExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err := ph.done(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.key(input.Key, true)
+	if err != nil {
+		return nil, err
+	}
+	old := t.items[key]
+	if !cond(old) {
+		return nil, conditionFailed()
+	}
+	updated, err := t.update(upd, old, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	t.items[key] = updated
+	t.record(old, updated)
+
+	output := &dynamodb.UpdateItemOutput{
+		ConsumedCapacity: consumed(input.ReturnConsumedCapacity, *input.TableName, 1, 1),
+	}
+	switch aws.StringValue(input.ReturnValues) {
+	case dynamodb.ReturnValueAllOld:
+		output.Attributes = clone(old)
+	case dynamodb.ReturnValueAllNew:
+		output.Attributes = clone(updated)
+	case dynamodb.ReturnValueUpdatedOld:
+		output.Attributes = pick(old, upd.attrs())
+	case dynamodb.ReturnValueUpdatedNew:
+		output.Attributes = pick(updated, upd.attrs())
+	}
+	return output, nil
+}
+
+// update returns the result of applying upd to old, or to a new item with the given key if old is nil.
+// Key attributes can't be updated.
+func (t *table) update(upd *update, old, key item) (item, error) {
+	pk, sk, _ := t.schema("")
+	for _, attr := range upd.attrs() {
+		if attr == pk || attr == sk {
+			return nil, validationError("One or more parameter values were invalid: Cannot update attribute %s. This attribute is part of the key", attr)
+		}
+	}
+	return upd.apply(old, key)
+}
+
+// pick returns a copy of the given attributes of it, or nil if it has none of them.
+func pick(it item, attrs []string) item {
+	var out item
+	for _, attr := range attrs {
+		if v, ok := it[attr]; ok {
+			if out == nil {
+				out = make(item)
+			}
+			out[attr] = v
+		}
+	}
+	return clone(out)
+}
+
+// txWrite is an operation of a write transaction.
+type txWrite struct {
+	t    *table
+	key  string
+	cond condition
+	// exactly one of these, or none for condition checks
+	put    item
+	upd    *update
+	keys   item
+	delete bool
+}
+
+// TransactWriteItemsWithContext checks every condition of the transaction and, if they all hold, applies every write.
+// If a condition fails, it returns a TransactionCanceledException with a reason for each operation.
+func (db *DB) TransactWriteItemsWithContext(_ aws.Context, input *dynamodb.TransactWriteItemsInput, _ ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	writes := make([]txWrite, 0, len(input.TransactItems))
+	seen := make(map[string]bool)
+	counts := make(map[string]int)
+	for _, ti := range input.TransactItems {
+		var w txWrite
+		var table *string
+		var key item
+		var names map[string]*string
+		var values map[string]*dynamodb.AttributeValue
+		var condExpr, updExpr *string
+		switch {
+		case ti.Put != nil:
+			table, key, w.put = ti.Put.TableName, ti.Put.Item, ti.Put.Item
+			names, values, condExpr = ti.Put.ExpressionAttributeNames, ti.Put.ExpressionAttributeValues, ti.Put.ConditionExpression
+		case ti.Update != nil:
+			table, key, w.keys = ti.Update.TableName, ti.Update.Key, ti.Update.Key
+			names, values, condExpr, updExpr = ti.Update.ExpressionAttributeNames, ti.Update.ExpressionAttributeValues, ti.Update.ConditionExpression, ti.Update.UpdateExpression
+		case ti.Delete != nil:
+			table, key, w.delete = ti.Delete.TableName, ti.Delete.Key, true
+			names, values, condExpr = ti.Delete.ExpressionAttributeNames, ti.Delete.ExpressionAttributeValues, ti.Delete.ConditionExpression
+		case ti.ConditionCheck != nil:
+			table, key = ti.ConditionCheck.TableName, ti.ConditionCheck.Key
+			names, values, condExpr = ti.ConditionCheck.ExpressionAttributeNames, ti.ConditionCheck.ExpressionAttributeValues, ti.ConditionCheck.ConditionExpression
+		default:
+			return nil, validationError("TransactItems can only contain one of Check, Put, Update or Delete")
+		}
+
+		var err error
+		if w.t, err = db.table(table); err != nil {
+			return nil, err
+		}
+		if w.key, err = w.t.key(key, w.put == nil); err != nil {
+			return nil, err
+		}
+		if id := aws.StringValue(table) + "\x00" + w.key; seen[id] {
+			return nil, validationError("Transaction request cannot include multiple operations on one item")
+		} else {
+			seen[id] = true
+		}
+		ph := newPlaceholders(names, values)
+		if w.cond, err = ph.condition(condExpr); err != nil {
+			return nil, err
+		}
+		if ti.Update != nil {
+			if w.upd, err = ph.update(updExpr); err != nil {
+				return nil, err
+			}
+		}
+		if err := ph.done(); err != nil {
+			return nil, err
+		}
+		writes = append(writes, w)
+		counts[aws.StringValue(table)]++
+	}
+
+	reasons := make([]*dynamodb.CancellationReason, len(writes))
+	codes := make([]string, len(writes))
+	canceled := false
+	for i, w := range writes {
+		codes[i] = "None"
+		if !w.cond(w.t.items[w.key]) {
+			codes[i] = "ConditionalCheckFailed"
+			canceled = true
+		}
+		reasons[i] = &dynamodb.CancellationReason{Code: aws.String(codes[i])}
+		if codes[i] != "None" {
+			reasons[i].Message = aws.String("The conditional request failed")
+		}
+	}
+	if canceled {
+		return nil, &dynamodb.TransactionCanceledException{
+			Message_:            aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons [" + strings.Join(codes, ", ") + "]"),
+			CancellationReasons: reasons,
+		}
+	}
+
+	updated := make([]item, len(writes))
+	for i, w := range writes {
+		if w.upd != nil {
+			var err error
+			if updated[i], err = w.t.update(w.upd, w.t.items[w.key], w.keys); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, w := range writes {
+		old := w.t.items[w.key]
+		switch {
+		case w.put != nil:
+			w.t.items[w.key] = clone(w.put)
+			w.t.record(old, w.put)
+		case w.upd != nil:
+			w.t.items[w.key] = updated[i]
+			w.t.record(old, updated[i])
+		case w.delete:
+			delete(w.t.items, w.key)
+			w.t.record(old, nil)
+		}
+	}
+
+	output := &dynamodb.TransactWriteItemsOutput{}
+	for _, name := range sortedKeys(counts) {
+		if cc := consumed(input.ReturnConsumedCapacity, name, counts[name], 2); cc != nil {
+			output.ConsumedCapacity = append(output.ConsumedCapacity, cc)
+		}
+	}
+	return output, nil
+}
+
+// TransactGetItemsWithContext gets items from several tables at once. Missing items have empty responses.
+func (db *DB) TransactGetItemsWithContext(_ aws.Context, input *dynamodb.TransactGetItemsInput, _ ...request.Option) (*dynamodb.TransactGetItemsOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	output := &dynamodb.TransactGetItemsOutput{}
+	counts := make(map[string]int)
+	for _, ti := range input.TransactItems {
+		get := ti.Get
+		ph := newPlaceholders(get.ExpressionAttributeNames, nil)
+		proj, err := ph.projection(get.ProjectionExpression)
+		if err != nil {
+			return nil, err
+		}
+		if err := ph.done(); err != nil {
+			return nil, err
+		}
+		t, err := db.table(get.TableName)
+		if err != nil {
+			return nil, err
+		}
+		key, err := t.key(get.Key, true)
+		if err != nil {
+			return nil, err
+		}
+		output.Responses = append(output.Responses, &dynamodb.ItemResponse{Item: project(t.items[key], proj)})
+		counts[aws.StringValue(get.TableName)]++
+	}
+	for _, name := range sortedKeys(counts) {
+		if cc := consumed(input.ReturnConsumedCapacity, name, counts[name], 2); cc != nil {
+			output.ConsumedCapacity = append(output.ConsumedCapacity, cc)
+		}
+	}
+	return output, nil
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TransactGetItems is used by guregu/dynamo's GetTx.Run.
+func (db *DB) TransactGetItems(input *dynamodb.TransactGetItemsInput) (*dynamodb.TransactGetItemsOutput, error) {
+	return db.TransactGetItemsWithContext(aws.BackgroundContext(), input)
+}
+
+func (db *DB) ExecuteStatementWithContext(aws.Context, *dynamodb.ExecuteStatementInput, ...request.Option) (*dynamodb.ExecuteStatementOutput, error) {
+	return nil, unsupported("PartiQL")
+}
+
+func (db *DB) QueryWithContext(_ aws.Context, input *dynamodb.QueryInput, _ ...request.Option) (*dynamodb.QueryOutput, error) {
+	if input.QueryFilter != nil || input.AttributesToGet != nil {
+		return nil, unsupported("QueryFilter and AttributesToGet")
+	}
+	ph := newPlaceholders(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	var keyCond condition
+	if input.KeyConditionExpression != nil {
+		var err error
+		if keyCond, err = ph.condition(input.KeyConditionExpression); err != nil {
+			return nil, err
+		}
+	}
+	filter, err := ph.condition(input.FilterExpression)
+	if err != nil {
+		return nil, err
+	}
+	proj, err := ph.projection(input.ProjectionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err := ph.done(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	pk, sk, err := t.schema(aws.StringValue(input.IndexName))
+	if err != nil {
+		return nil, err
+	}
+
+	if keyCond == nil {
+		if keyCond, err = legacyKeyCondition(input.KeyConditions, pk, sk); err != nil {
+			return nil, err
+		}
+	}
+
+	var items []item
+	for _, it := range t.items {
+		if it[pk] == nil || (sk != "" && it[sk] == nil) {
+			// not in this index
+			continue
+		}
+		if keyCond(it) {
+			items = append(items, it)
+		}
+	}
+	t.sort(items, sk)
+	if input.ScanIndexForward != nil && !*input.ScanIndexForward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	items, last := t.page(items, input.ExclusiveStartKey, input.Limit, pk, sk)
+	scanned := len(items)
+	items = filterItems(items, filter)
+	output := &dynamodb.QueryOutput{
+		Count:            aws.Int64(int64(len(items))),
+		ScannedCount:     aws.Int64(int64(scanned)),
+		LastEvaluatedKey: last,
+		ConsumedCapacity: consumed(input.ReturnConsumedCapacity, *input.TableName, scanned, readUnit(input.ConsistentRead)),
+	}
+	if aws.StringValue(input.Select) != dynamodb.SelectCount {
+		output.Items = t.project(aws.StringValue(input.IndexName), items, proj)
+	}
+	return output, nil
+}
+
+// legacyKeyCondition converts the KeyConditions parameter of a query into a condition.
+func legacyKeyCondition(conds map[string]*dynamodb.Condition, pk, sk string) (condition, error) {
+	pkCond, ok := conds[pk]
+	if !ok || aws.StringValue(pkCond.ComparisonOperator) != dynamodb.ComparisonOperatorEq || len(pkCond.AttributeValueList) != 1 {
+		return nil, validationError("Query condition missed key schema element: %s", pk)
+	}
+	skCond, hasSK := conds[sk]
+	if len(conds) > 2 || (len(conds) == 2 && !hasSK) {
+		return nil, validationError("Query key condition not supported")
+	}
+	if hasSK {
+		// check the operator and arguments up front
+		if _, err := matches(&dynamodb.AttributeValue{}, skCond); err != nil {
+			return nil, err
+		}
+	}
+	return func(it item) bool {
+		if compare(it[pk], pkCond.AttributeValueList[0]) != 0 {
+			return false
+		}
+		if hasSK {
+			match, _ := matches(it[sk], skCond)
+			return match
+		}
+		return true
+	}, nil
+}
+
+// filterItems returns the items that satisfy filter.
+func filterItems(items []item, filter condition) []item {
+	out := items[:0:0]
+	for _, it := range items {
+		if filter(it) {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+func (db *DB) ScanWithContext(_ aws.Context, input *dynamodb.ScanInput, _ ...request.Option) (*dynamodb.ScanOutput, error) {
+	if input.ScanFilter != nil || input.AttributesToGet != nil {
+		return nil, unsupported("ScanFilter and AttributesToGet")
+	}
+	ph := newPlaceholders(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	filter, err := ph.condition(input.FilterExpression)
+	if err != nil {
+		return nil, err
+	}
+	proj, err := ph.projection(input.ProjectionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err := ph.done(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	pk, sk, err := t.schema(aws.StringValue(input.IndexName))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []item
+	for _, it := range t.items {
+		if it[pk] == nil || (sk != "" && it[sk] == nil) {
+			continue
+		}
+		items = append(items, it)
+	}
+	t.sort(items, "")
+	if total := aws.Int64Value(input.TotalSegments); total > 0 {
+		segment := aws.Int64Value(input.Segment)
+		var seg []item
+		for i, it := range items {
+			if int64(i)%total == segment {
+				seg = append(seg, it)
+			}
+		}
+		items = seg
+	}
+
+	items, last := t.page(items, input.ExclusiveStartKey, input.Limit, pk, sk)
+	scanned := len(items)
+	items = filterItems(items, filter)
+	output := &dynamodb.ScanOutput{
+		Count:            aws.Int64(int64(len(items))),
+		ScannedCount:     aws.Int64(int64(scanned)),
+		LastEvaluatedKey: last,
+		ConsumedCapacity: consumed(input.ReturnConsumedCapacity, *input.TableName, scanned, readUnit(input.ConsistentRead)),
+	}
+	if aws.StringValue(input.Select) != dynamodb.SelectCount {
+		output.Items = t.project(aws.StringValue(input.IndexName), items, proj)
+	}
+	return output, nil
+}
+
+// describe returns a copy of the table's description.
+func (t *table) describe() *dynamodb.TableDescription {
+	desc := awsutil.CopyOf(t.desc).(*dynamodb.TableDescription)
+	desc.ItemCount = aws.Int64(int64(len(t.items)))
+	desc.TableSizeBytes = aws.Int64(0)
+	return desc
+}
+
+// schema returns the partition and sort key of the table or the given index.
+// sk is empty if there is no sort key.
+func (t *table) schema(index string) (pk, sk string, err error) {
+	schema := t.desc.KeySchema
+	if index != "" {
+		schema = nil
+		for _, gsi := range t.desc.GlobalSecondaryIndexes {
+			if aws.StringValue(gsi.IndexName) == index {
+				schema = gsi.KeySchema
+			}
+		}
+		for _, lsi := range t.desc.LocalSecondaryIndexes {
+			if aws.StringValue(lsi.IndexName) == index {
+				schema = lsi.KeySchema
+			}
+		}
+		if schema == nil {
+			return "", "", validationError("The table does not have the specified index: %s", index)
+		}
+	}
+	for _, ks := range schema {
+		switch aws.StringValue(ks.KeyType) {
+		case dynamodb.KeyTypeHash:
+			pk = aws.StringValue(ks.AttributeName)
+		case dynamodb.KeyTypeRange:
+			sk = aws.StringValue(ks.AttributeName)
+		}
+	}
+	if pk == "" {
+		return "", "", validationError("No hash key in key schema")
+	}
+	return pk, sk, nil
+}
+
+// key validates the primary key attributes of it, returning a string that uniquely identifies the key.
+// If exact is true, it must only contain the key attributes.
+func (t *table) key(it item, exact bool) (string, error) {
+	pk, sk, _ := t.schema("")
+	attrs := []string{pk}
+	if sk != "" {
+		attrs = append(attrs, sk)
+	}
+	if exact && len(it) != len(attrs) {
+		return "", validationError("The provided key element does not match the schema")
+	}
+
+	var key strings.Builder
+	for _, attr := range attrs {
+		av := it[attr]
+		if av == nil {
+			return "", validationError("One of the required keys was not given a value: %s", attr)
+		}
+		typ := t.attributeType(attr)
+		if attributeType(av) != typ {
+			return "", validationError("Type mismatch for key %s expected: %s actual: %s", attr, typ, attributeType(av))
+		}
+		if av.N != nil {
+			if _, ok := new(big.Rat).SetString(*av.N); !ok {
+				return "", validationError("The parameter cannot be converted to a numeric value: %s", *av.N)
+			}
+		}
+		key.WriteString(typ)
+		key.WriteByte(':')
+		key.WriteString(canonical(av))
+		key.WriteByte(0)
+	}
+	return key.String(), nil
+}
+
+func (t *table) attributeType(name string) string {
+	for _, ad := range t.desc.AttributeDefinitions {
+		if aws.StringValue(ad.AttributeName) == name {
+			return aws.StringValue(ad.AttributeType)
+		}
+	}
+	return ""
+}
+
+// sort sorts items by the attribute sk, then by primary key.
+func (t *table) sort(items []item, sk string) {
+	pk, tsk, _ := t.schema("")
+	sort.SliceStable(items, func(i, j int) bool {
+		for _, attr := range []string{sk, pk, tsk} {
+			if attr == "" {
+				continue
+			}
+			if c := compare(items[i][attr], items[j][attr]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// page returns the items after the start key, up to limit, and the key to continue from.
+func (t *table) page(items []item, start item, limit *int64, pk, sk string) ([]item, item) {
+	if start != nil {
+		startKey, err := t.key(start, false)
+		if err == nil {
+			for i, it := range items {
+				if key, _ := t.key(it, false); key == startKey {
+					items = items[i+1:]
+					break
+				}
+			}
+		}
+	}
+
+	n := int(aws.Int64Value(limit))
+	if n <= 0 || len(items) <= n {
+		return items, nil
+	}
+	items = items[:n]
+
+	last := items[n-1]
+	tpk, tsk, _ := t.schema("")
+	lastKey := make(item)
+	for _, attr := range []string{pk, sk, tpk, tsk} {
+		if attr != "" {
+			lastKey[attr] = last[attr]
+		}
+	}
+	return items, clone(lastKey)
+}
+
+// matches reports whether av satisfies the legacy key condition cond.
+func matches(av *dynamodb.AttributeValue, cond *dynamodb.Condition) (bool, error) {
+	values := cond.AttributeValueList
+	need := 1
+	op := aws.StringValue(cond.ComparisonOperator)
+	if op == dynamodb.ComparisonOperatorBetween {
+		need = 2
+	}
+	if len(values) != need {
+		return false, validationError("Invalid number of argument(s) for the %s ComparisonOperator", op)
+	}
+	for _, v := range values {
+		if attributeType(v) != attributeType(av) {
+			return false, nil
+		}
+	}
+
+	switch op {
+	case dynamodb.ComparisonOperatorEq:
+		return compare(av, values[0]) == 0, nil
+	case dynamodb.ComparisonOperatorLt:
+		return compare(av, values[0]) < 0, nil
+	case dynamodb.ComparisonOperatorLe:
+		return compare(av, values[0]) <= 0, nil
+	case dynamodb.ComparisonOperatorGt:
+		return compare(av, values[0]) > 0, nil
+	case dynamodb.ComparisonOperatorGe:
+		return compare(av, values[0]) >= 0, nil
+	case dynamodb.ComparisonOperatorBetween:
+		return compare(av, values[0]) >= 0 && compare(av, values[1]) <= 0, nil
+	case dynamodb.ComparisonOperatorBeginsWith:
+		switch {
+		case av.S != nil:
+			return strings.HasPrefix(*av.S, aws.StringValue(values[0].S)), nil
+		case av.B != nil:
+			return bytes.HasPrefix(av.B, values[0].B), nil
+		}
+		return false, validationError("Invalid type for BEGINS_WITH")
+	}
+	return false, validationError("Unsupported key condition operator: %s", op)
+}
+
+// compare compares two scalar values of the same type.
+// Values of different types are ordered by type.
+func compare(a, b *dynamodb.AttributeValue) int {
+	if ta, tb := attributeType(a), attributeType(b); ta != tb {
+		return strings.Compare(ta, tb)
+	}
+	switch {
+	case a == nil:
+		return 0
+	case a.N != nil:
+		return number(*a.N).Cmp(number(*b.N))
+	case a.S != nil:
+		return strings.Compare(*a.S, *b.S)
+	case a.B != nil:
+		return bytes.Compare(a.B, b.B)
+	}
+	return 0
+}
+
+func attributeType(av *dynamodb.AttributeValue) string {
+	switch {
+	case av == nil:
+		return ""
+	case av.S != nil:
+		return dynamodb.ScalarAttributeTypeS
+	case av.N != nil:
+		return dynamodb.ScalarAttributeTypeN
+	case av.B != nil:
+		return dynamodb.ScalarAttributeTypeB
+	}
+	return "?"
+}
+
+// canonical returns a string representation of the scalar av, such that equal numbers are equal.
+func canonical(av *dynamodb.AttributeValue) string {
+	switch {
+	case av.N != nil:
+		return number(*av.N).RatString()
+	case av.S != nil:
+		return *av.S
+	}
+	return string(av.B)
+}
+
+func number(n string) *big.Rat {
+	r, ok := new(big.Rat).SetString(n)
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+func clone(it item) item {
+	if it == nil {
+		return nil
+	}
+	return *awsutil.CopyOf(&it).(*item)
+}
+
+// project returns copies of items with only the attributes projected into index,
+// and only the given paths if there are any.
+func (t *table) project(index string, items []item, paths []path) []item {
+	proj := t.projection(index)
+	out := make([]item, 0, len(items))
+	for _, it := range items {
+		it = project(it, paths)
+		if proj != nil {
+			for attr := range it {
+				if !proj[attr] {
+					delete(it, attr)
+				}
+			}
+		}
+		out = append(out, it)
+	}
+	return out
+}
+
+// projection returns the set of attributes projected into index, or nil for all attributes.
+func (t *table) projection(index string) map[string]bool {
+	if index == "" {
+		return nil
+	}
+	var schema []*dynamodb.KeySchemaElement
+	var proj *dynamodb.Projection
+	for _, gsi := range t.desc.GlobalSecondaryIndexes {
+		if aws.StringValue(gsi.IndexName) == index {
+			schema, proj = gsi.KeySchema, gsi.Projection
+		}
+	}
+	for _, lsi := range t.desc.LocalSecondaryIndexes {
+		if aws.StringValue(lsi.IndexName) == index {
+			schema, proj = lsi.KeySchema, lsi.Projection
+		}
+	}
+	if proj == nil || aws.StringValue(proj.ProjectionType) == dynamodb.ProjectionTypeAll {
+		return nil
+	}
+
+	attrs := make(map[string]bool)
+	for _, ks := range append(schema, t.desc.KeySchema...) {
+		attrs[aws.StringValue(ks.AttributeName)] = true
+	}
+	for _, attr := range proj.NonKeyAttributes {
+		attrs[aws.StringValue(attr)] = true
+	}
+	return attrs
+}
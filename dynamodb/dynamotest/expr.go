@@ -0,0 +1,1141 @@
+package dynamotest
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// placeholders resolves the #name and :value placeholders of a request's expressions
+// and remembers which ones were used, because DynamoDB rejects unused placeholders.
+type placeholders struct {
+	names  map[string]*string
+	values map[string]*dynamodb.AttributeValue
+	used   map[string]bool
+}
+
+func newPlaceholders(names map[string]*string, values map[string]*dynamodb.AttributeValue) *placeholders {
+	return &placeholders{
+		names:  names,
+		values: values,
+		used:   make(map[string]bool),
+	}
+}
+
+// done returns an error if any placeholder wasn't used by the request's expressions.
+func (ph *placeholders) done() error {
+	for _, unused := range []struct {
+		what string
+		keys []string
+	}{
+		{"ExpressionAttributeNames", ph.unused(ph.names)},
+		{"ExpressionAttributeValues", ph.unused(ph.values)},
+	} {
+		if len(unused.keys) > 0 {
+			return validationError("Value provided in %s unused in expressions: keys: {%s}", unused.what, strings.Join(unused.keys, ", "))
+		}
+	}
+	return nil
+}
+
+func (ph *placeholders) unused(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*string:
+		for k := range m {
+			if !ph.used[k] {
+				keys = append(keys, k)
+			}
+		}
+	case map[string]*dynamodb.AttributeValue:
+		for k := range m {
+			if !ph.used[k] {
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// condition parses a condition expression (also used for filters and key conditions).
+// A nil expression is a condition that always holds.
+func (ph *placeholders) condition(expr *string) (condition, error) {
+	if expr == nil {
+		return func(item) bool { return true }, nil
+	}
+	p, err := ph.parser(*expr)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := p.condition()
+	if err != nil {
+		return nil, err
+	}
+	return cond, p.end()
+}
+
+// projection parses a projection expression. A nil expression projects every attribute, returning nil.
+func (ph *placeholders) projection(expr *string) ([]path, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	p, err := ph.parser(*expr)
+	if err != nil {
+		return nil, err
+	}
+	var paths []path
+	for {
+		path, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return paths, p.end()
+}
+
+// update parses an update expression. A nil expression doesn't change anything.
+func (ph *placeholders) update(expr *string) (*update, error) {
+	u := new(update)
+	if expr == nil {
+		return u, nil
+	}
+	p, err := ph.parser(*expr)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for p.peek().kind != tokEOF {
+		verb := strings.ToUpper(p.next().text)
+		switch verb {
+		case "SET", "REMOVE", "ADD", "DELETE":
+		default:
+			return nil, p.syntaxError()
+		}
+		if seen[verb] {
+			return nil, validationError("Invalid UpdateExpression: The \"%s\" section can only be used once in an update expression", verb)
+		}
+		seen[verb] = true
+		for {
+			if err := p.action(verb, u); err != nil {
+				return nil, err
+			}
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if len(u.actions) == 0 {
+		return nil, p.syntaxError()
+	}
+	return u, nil
+}
+
+func (ph *placeholders) parser(expr string) (*parser, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{expr: expr, toks: toks, ph: ph}, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF   tokenKind = iota
+	tokIdent           // attribute name, keyword, or function name
+	tokName            // #name placeholder
+	tokValue           // :value placeholder
+	tokIndex           // list index
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lex(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(expr) && isIdent(expr[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, validationError("Invalid expression: Syntax error; token: %q, expression: %s", string(c), expr)
+			}
+			kind := tokName
+			if c == ':' {
+				kind = tokValue
+			}
+			toks = append(toks, token{kind: kind, text: expr[i:j]})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+				j++
+			}
+			toks = append(toks, token{kind: tokIndex, text: expr[i:j]})
+			i = j
+		case isIdent(c):
+			j := i
+			for j < len(expr) && isIdent(expr[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: expr[i:j]})
+			i = j
+		default:
+			if i+1 < len(expr) {
+				switch two := expr[i : i+2]; two {
+				case "<>", "<=", ">=":
+					toks = append(toks, token{kind: tokPunct, text: two})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("()[],.=<>+-", rune(c)) {
+				return nil, validationError("Invalid expression: Syntax error; token: %q, expression: %s", string(c), expr)
+			}
+			toks = append(toks, token{kind: tokPunct, text: string(c)})
+			i++
+		}
+	}
+	return append(toks, token{kind: tokEOF}), nil
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// parser is a recursive descent parser for DynamoDB expressions.
+type parser struct {
+	expr string
+	toks []token
+	pos  int
+	ph   *placeholders
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it's the punctuation s.
+func (p *parser) accept(s string) bool {
+	if tok := p.peek(); tok.kind == tokPunct && tok.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// keyword consumes the next token if it's the keyword kw, in any case.
+func (p *parser) keyword(kw string) bool {
+	if tok := p.peek(); tok.kind == tokIdent && strings.EqualFold(tok.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+// call reports whether the next tokens are a call of the function fn, and consumes its opening parenthesis.
+func (p *parser) call(fn string) bool {
+	if tok := p.peek(); tok.kind == tokIdent && tok.text == fn {
+		if next := p.toks[p.pos+1]; next.kind == tokPunct && next.text == "(" {
+			p.pos += 2
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) end() error {
+	if p.peek().kind != tokEOF {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+func (p *parser) syntaxError() error {
+	tok := p.peek().text
+	if p.peek().kind == tokEOF {
+		tok = "<EOF>"
+	}
+	return validationError("Invalid expression: Syntax error; token: %q, expression: %s", tok, p.expr)
+}
+
+// condition is a parsed condition expression.
+type condition func(item) bool
+
+// operand is a parsed operand of a condition. It returns nil for missing attributes.
+type operand func(item) *dynamodb.AttributeValue
+
+// condition parses OR, which has the lowest precedence.
+func (p *parser) condition() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(it item) bool { return l(it) || right(it) }
+	}
+	return left, nil
+}
+
+func (p *parser) and() (condition, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(it item) bool { return l(it) && right(it) }
+	}
+	return left, nil
+}
+
+func (p *parser) not() (condition, error) {
+	if p.keyword("NOT") {
+		cond, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(it item) bool { return !cond(it) }, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (condition, error) {
+	if p.accept("(") {
+		cond, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		return cond, p.expect(")")
+	}
+
+	for _, fn := range []string{"attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains"} {
+		if p.call(fn) {
+			return p.function(fn)
+		}
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.keyword("BETWEEN"):
+		lo, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, p.syntaxError()
+		}
+		hi, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return func(it item) bool {
+			v := left(it)
+			return ordered(v, lo(it)) && ordered(v, hi(it)) && compare(v, lo(it)) >= 0 && compare(v, hi(it)) <= 0
+		}, nil
+	case p.keyword("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		var list []operand
+		for {
+			v, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) bool {
+			v := left(it)
+			for _, o := range list {
+				if v != nil && equal(v, o(it)) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	op := p.peek()
+	if op.kind != tokPunct {
+		return nil, p.syntaxError()
+	}
+	p.pos++
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case "=":
+		return func(it item) bool {
+			l := left(it)
+			return l != nil && equal(l, right(it))
+		}, nil
+	case "<>":
+		return func(it item) bool { return !equal(left(it), right(it)) }, nil
+	case "<", "<=", ">", ">=":
+		return func(it item) bool {
+			l, r := left(it), right(it)
+			if !ordered(l, r) {
+				return false
+			}
+			c := compare(l, r)
+			switch op.text {
+			case "<":
+				return c < 0
+			case "<=":
+				return c <= 0
+			case ">":
+				return c > 0
+			}
+			return c >= 0
+		}, nil
+	}
+	p.pos--
+	return nil, p.syntaxError()
+}
+
+// function parses the arguments of a condition function, after its opening parenthesis.
+func (p *parser) function(fn string) (condition, error) {
+	attr, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	var arg operand
+	switch fn {
+	case "attribute_type", "begins_with", "contains":
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if arg, err = p.operand(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	switch fn {
+	case "attribute_exists":
+		return func(it item) bool { return attr.get(it) != nil }, nil
+	case "attribute_not_exists":
+		return func(it item) bool { return attr.get(it) == nil }, nil
+	case "attribute_type":
+		return func(it item) bool {
+			v, typ := attr.get(it), arg(it)
+			return v != nil && typ != nil && typ.S != nil && typeOf(v) == *typ.S
+		}, nil
+	case "begins_with":
+		return func(it item) bool {
+			v, prefix := attr.get(it), arg(it)
+			switch {
+			case v == nil || prefix == nil:
+				return false
+			case v.S != nil && prefix.S != nil:
+				return strings.HasPrefix(*v.S, *prefix.S)
+			case v.B != nil && prefix.B != nil:
+				return bytes.HasPrefix(v.B, prefix.B)
+			}
+			return false
+		}, nil
+	}
+	// contains
+	return func(it item) bool {
+		v, elem := attr.get(it), arg(it)
+		switch {
+		case v == nil || elem == nil:
+			return false
+		case v.S != nil && elem.S != nil:
+			return strings.Contains(*v.S, *elem.S)
+		case v.B != nil && elem.B != nil:
+			return bytes.Contains(v.B, elem.B)
+		case v.L != nil:
+			for _, e := range v.L {
+				if equal(e, elem) {
+					return true
+				}
+			}
+			return false
+		}
+		for _, e := range elements(v) {
+			if equal(e, elem) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// operand parses a value placeholder, size(Path), or a path.
+func (p *parser) operand() (operand, error) {
+	if tok := p.peek(); tok.kind == tokValue {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return func(item) *dynamodb.AttributeValue { return v }, nil
+	}
+	if p.call("size") {
+		attr, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) *dynamodb.AttributeValue {
+			n, ok := size(attr.get(it))
+			if !ok {
+				return nil
+			}
+			return &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(n))}
+		}, nil
+	}
+	attr, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	return attr.get, nil
+}
+
+func (p *parser) value() (*dynamodb.AttributeValue, error) {
+	tok := p.next()
+	v, ok := p.ph.values[tok.text]
+	if !ok {
+		return nil, validationError("Value provided in ExpressionAttributeValues is missing: %s", tok.text)
+	}
+	p.ph.used[tok.text] = true
+	return v, nil
+}
+
+// pathElem is an element of a document path: an attribute name, or a list index if name is empty.
+type pathElem struct {
+	name  string
+	index int
+}
+
+// path is a document path, like a.b[1].c.
+type path []pathElem
+
+func (p *parser) path() (path, error) {
+	first, err := p.attrName()
+	if err != nil {
+		return nil, err
+	}
+	attr := path{{name: first}}
+	for {
+		switch {
+		case p.accept("."):
+			name, err := p.attrName()
+			if err != nil {
+				return nil, err
+			}
+			attr = append(attr, pathElem{name: name})
+		case p.accept("["):
+			tok := p.next()
+			if tok.kind != tokIndex {
+				p.pos--
+				return nil, p.syntaxError()
+			}
+			i, err := strconv.Atoi(tok.text)
+			if err != nil {
+				return nil, validationError("Invalid list index: %s", tok.text)
+			}
+			attr = append(attr, pathElem{index: i})
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		default:
+			return attr, nil
+		}
+	}
+}
+
+func (p *parser) attrName() (string, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokName:
+		name, ok := p.ph.names[tok.text]
+		if !ok {
+			return "", validationError("An expression attribute name used in the document path is not defined; attribute name: %s", tok.text)
+		}
+		p.ph.used[tok.text] = true
+		return aws.StringValue(name), nil
+	case tokIdent:
+		switch strings.ToUpper(tok.text) {
+		case "AND", "OR", "NOT", "BETWEEN", "IN", "SET", "REMOVE", "ADD", "DELETE":
+			p.pos--
+			return "", p.syntaxError()
+		}
+		return tok.text, nil
+	}
+	p.pos--
+	return "", p.syntaxError()
+}
+
+// get returns the value at the path in it, or nil if there isn't one.
+func (attr path) get(it item) *dynamodb.AttributeValue {
+	v := &dynamodb.AttributeValue{M: it}
+	for _, elem := range attr {
+		switch {
+		case elem.name != "" && v.M != nil:
+			v = v.M[elem.name]
+		case elem.name == "" && v.L != nil && elem.index < len(v.L):
+			v = v.L[elem.index]
+		default:
+			return nil
+		}
+		if v == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+// parent returns the map or list holding the last element of the path.
+func (attr path) parent(it item) (*dynamodb.AttributeValue, error) {
+	parent := &dynamodb.AttributeValue{M: it}
+	if len(attr) > 1 {
+		parent = attr[:len(attr)-1].get(it)
+	}
+	last := attr[len(attr)-1]
+	if parent == nil || (last.name != "" && parent.M == nil) || (last.name == "" && parent.L == nil) {
+		return nil, validationError("The document path provided in the update expression is invalid for update")
+	}
+	return parent, nil
+}
+
+// set sets the value at the path in it. Setting a list index past the end of the list appends to it.
+func (attr path) set(it item, v *dynamodb.AttributeValue) error {
+	parent, err := attr.parent(it)
+	if err != nil {
+		return err
+	}
+	last := attr[len(attr)-1]
+	switch {
+	case last.name != "":
+		parent.M[last.name] = v
+	case last.index < len(parent.L):
+		parent.L[last.index] = v
+	default:
+		parent.L = append(parent.L, v)
+	}
+	return nil
+}
+
+// remove removes the value at the path in it, if there is one.
+func (attr path) remove(it item) {
+	parent, err := attr.parent(it)
+	if err != nil {
+		return
+	}
+	last := attr[len(attr)-1]
+	switch {
+	case last.name != "":
+		delete(parent.M, last.name)
+	case last.index < len(parent.L):
+		parent.L = append(parent.L[:last.index:last.index], parent.L[last.index+1:]...)
+	}
+}
+
+// project returns a copy of it with only the given paths.
+func project(it item, paths []path) item {
+	if it == nil || paths == nil {
+		return clone(it)
+	}
+	out := make(item)
+	for _, attr := range paths {
+		v := attr.get(it)
+		if v == nil {
+			continue
+		}
+		dst := &dynamodb.AttributeValue{M: out}
+		for i, elem := range attr {
+			leaf := i == len(attr)-1
+			var next *dynamodb.AttributeValue
+			switch {
+			case leaf:
+				next = clone(item{"v": v})["v"]
+			case attr[i+1].name != "":
+				next = &dynamodb.AttributeValue{M: make(item)}
+			default:
+				next = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+			}
+			if elem.name != "" {
+				if existing := dst.M[elem.name]; existing != nil && !leaf {
+					next = existing
+				}
+				dst.M[elem.name] = next
+			} else {
+				dst.L = append(dst.L, next)
+			}
+			dst = next
+		}
+	}
+	return out
+}
+
+// update is a parsed update expression.
+type update struct {
+	actions []updateAction
+	// paths changed by the actions
+	paths []path
+}
+
+// updateAction applies a single action to the new item. Values are read from the old item.
+type updateAction func(old, new item) error
+
+// apply returns a copy of old, or of key if old is nil, with the update applied.
+func (u *update) apply(old, key item) (item, error) {
+	updated := clone(old)
+	if updated == nil {
+		updated = clone(key)
+	}
+	for _, action := range u.actions {
+		if err := action(old, updated); err != nil {
+			return nil, err
+		}
+	}
+	return updated, nil
+}
+
+// attrs returns the top-level attributes changed by the update.
+func (u *update) attrs() []string {
+	var attrs []string
+	seen := make(map[string]bool)
+	for _, attr := range u.paths {
+		if name := attr[0].name; !seen[name] {
+			seen[name] = true
+			attrs = append(attrs, name)
+		}
+	}
+	return attrs
+}
+
+// action parses an action of the section verb and adds it to u.
+func (p *parser) action(verb string, u *update) error {
+	attr, err := p.path()
+	if err != nil {
+		return err
+	}
+	u.paths = append(u.paths, attr)
+
+	switch verb {
+	case "REMOVE":
+		u.actions = append(u.actions, func(_, updated item) error {
+			attr.remove(updated)
+			return nil
+		})
+		return nil
+	case "SET":
+		if err := p.expect("="); err != nil {
+			return err
+		}
+		value, err := p.setValue()
+		if err != nil {
+			return err
+		}
+		u.actions = append(u.actions, func(old, updated item) error {
+			v, err := value(old)
+			if err != nil {
+				return err
+			}
+			return attr.set(updated, v)
+		})
+		return nil
+	}
+
+	if p.peek().kind != tokValue {
+		return p.syntaxError()
+	}
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	if verb == "ADD" {
+		u.actions = append(u.actions, func(_, updated item) error {
+			cur := attr.get(updated)
+			switch {
+			case cur == nil && (v.N != nil || isSet(v)):
+				return attr.set(updated, v)
+			case cur != nil && cur.N != nil && v.N != nil:
+				return attr.set(updated, &dynamodb.AttributeValue{N: aws.String(formatNumber(new(big.Rat).Add(number(*cur.N), number(*v.N))))})
+			case cur != nil && isSet(v) && typeOf(cur) == typeOf(v):
+				return attr.set(updated, union(cur, v))
+			}
+			return validationError("An operand in the update expression has an incorrect data type")
+		})
+		return nil
+	}
+	// DELETE
+	u.actions = append(u.actions, func(_, updated item) error {
+		cur := attr.get(updated)
+		switch {
+		case cur == nil:
+			return nil
+		case !isSet(v) || typeOf(cur) != typeOf(v):
+			return validationError("An operand in the update expression has an incorrect data type")
+		}
+		if rest := difference(cur, v); rest != nil {
+			return attr.set(updated, rest)
+		}
+		attr.remove(updated)
+		return nil
+	})
+	return nil
+}
+
+// valueFunc is a parsed value of a SET action.
+type valueFunc func(old item) (*dynamodb.AttributeValue, error)
+
+// setValue parses the value of a SET action: an operand, or two operands added or subtracted.
+func (p *parser) setValue() (valueFunc, error) {
+	left, err := p.setOperand()
+	if err != nil {
+		return nil, err
+	}
+	var sign int
+	switch {
+	case p.accept("+"):
+		sign = 1
+	case p.accept("-"):
+		sign = -1
+	default:
+		return left, nil
+	}
+	right, err := p.setOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(old item) (*dynamodb.AttributeValue, error) {
+		l, err := left(old)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(old)
+		if err != nil {
+			return nil, err
+		}
+		if l.N == nil || r.N == nil {
+			return nil, validationError("An operand in the update expression has an incorrect data type")
+		}
+		n := number(*r.N)
+		if sign < 0 {
+			n.Neg(n)
+		}
+		return &dynamodb.AttributeValue{N: aws.String(formatNumber(n.Add(n, number(*l.N))))}, nil
+	}, nil
+}
+
+// setOperand parses a value placeholder, a path, if_not_exists(Path, Value), or list_append(List1, List2).
+func (p *parser) setOperand() (valueFunc, error) {
+	switch {
+	case p.call("if_not_exists"):
+		attr, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		fallback, err := p.setOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(old item) (*dynamodb.AttributeValue, error) {
+			if v := attr.get(old); v != nil {
+				return v, nil
+			}
+			return fallback(old)
+		}, nil
+	case p.call("list_append"):
+		a, err := p.setOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		b, err := p.setOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(old item) (*dynamodb.AttributeValue, error) {
+			l, err := a(old)
+			if err != nil {
+				return nil, err
+			}
+			r, err := b(old)
+			if err != nil {
+				return nil, err
+			}
+			if l.L == nil || r.L == nil {
+				return nil, validationError("An operand in the update expression has an incorrect data type")
+			}
+			list := append(append([]*dynamodb.AttributeValue{}, l.L...), r.L...)
+			return &dynamodb.AttributeValue{L: list}, nil
+		}, nil
+	case p.peek().kind == tokValue:
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return func(item) (*dynamodb.AttributeValue, error) { return v, nil }, nil
+	}
+	attr, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	return func(old item) (*dynamodb.AttributeValue, error) {
+		v := attr.get(old)
+		if v == nil {
+			return nil, validationError("The provided expression refers to an attribute that does not exist in the item")
+		}
+		return v, nil
+	}, nil
+}
+
+// typeOf returns the DynamoDB type of av, such as S or NS, or "" for nil.
+func typeOf(av *dynamodb.AttributeValue) string {
+	switch {
+	case av == nil:
+		return ""
+	case av.S != nil:
+		return "S"
+	case av.N != nil:
+		return "N"
+	case av.B != nil:
+		return "B"
+	case av.BOOL != nil:
+		return "BOOL"
+	case av.NULL != nil:
+		return "NULL"
+	case av.SS != nil:
+		return "SS"
+	case av.NS != nil:
+		return "NS"
+	case av.BS != nil:
+		return "BS"
+	case av.L != nil:
+		return "L"
+	}
+	return "M"
+}
+
+func isSet(av *dynamodb.AttributeValue) bool {
+	switch typeOf(av) {
+	case "SS", "NS", "BS":
+		return true
+	}
+	return false
+}
+
+// ordered reports whether a and b can be compared with <, <=, >, and >=.
+func ordered(a, b *dynamodb.AttributeValue) bool {
+	if a == nil || b == nil || typeOf(a) != typeOf(b) {
+		return false
+	}
+	switch typeOf(a) {
+	case "S", "N", "B":
+		return true
+	}
+	return false
+}
+
+// elements returns the elements of the set av as scalar values.
+func elements(av *dynamodb.AttributeValue) []*dynamodb.AttributeValue {
+	var elems []*dynamodb.AttributeValue
+	for _, s := range av.SS {
+		elems = append(elems, &dynamodb.AttributeValue{S: s})
+	}
+	for _, n := range av.NS {
+		elems = append(elems, &dynamodb.AttributeValue{N: n})
+	}
+	for _, b := range av.BS {
+		elems = append(elems, &dynamodb.AttributeValue{B: b})
+	}
+	return elems
+}
+
+// setOf returns a set of the same type as like with the given elements, or nil if there are none.
+func setOf(like *dynamodb.AttributeValue, elems []*dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	if len(elems) == 0 {
+		return nil
+	}
+	set := new(dynamodb.AttributeValue)
+	for _, e := range elems {
+		switch typeOf(like) {
+		case "SS":
+			set.SS = append(set.SS, e.S)
+		case "NS":
+			set.NS = append(set.NS, e.N)
+		case "BS":
+			set.BS = append(set.BS, e.B)
+		}
+	}
+	return set
+}
+
+func union(a, b *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	elems := elements(a)
+	for _, e := range elements(b) {
+		if !containsValue(elems, e) {
+			elems = append(elems, e)
+		}
+	}
+	return setOf(a, elems)
+}
+
+func difference(a, b *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	var elems []*dynamodb.AttributeValue
+	remove := elements(b)
+	for _, e := range elements(a) {
+		if !containsValue(remove, e) {
+			elems = append(elems, e)
+		}
+	}
+	return setOf(a, elems)
+}
+
+func containsValue(list []*dynamodb.AttributeValue, av *dynamodb.AttributeValue) bool {
+	for _, e := range list {
+		if equal(e, av) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal reports whether a and b are the same value. Numbers are compared numerically and sets ignore order.
+func equal(a, b *dynamodb.AttributeValue) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if typeOf(a) != typeOf(b) {
+		return false
+	}
+	switch typeOf(a) {
+	case "S", "N", "B":
+		return compare(a, b) == 0
+	case "BOOL":
+		return *a.BOOL == *b.BOOL
+	case "NULL":
+		return true
+	case "SS", "NS", "BS":
+		ea, eb := elements(a), elements(b)
+		if len(ea) != len(eb) {
+			return false
+		}
+		for _, e := range ea {
+			if !containsValue(eb, e) {
+				return false
+			}
+		}
+		return true
+	case "L":
+		if len(a.L) != len(b.L) {
+			return false
+		}
+		for i := range a.L {
+			if !equal(a.L[i], b.L[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if len(a.M) != len(b.M) {
+		return false
+	}
+	for k, v := range a.M {
+		if !equal(v, b.M[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// size returns the result of the size function for av: the length of strings and binaries,
+// and the number of elements of sets, lists, and maps.
+func size(av *dynamodb.AttributeValue) (int, bool) {
+	switch typeOf(av) {
+	case "S":
+		return utf8.RuneCountInString(*av.S), true
+	case "B":
+		return len(av.B), true
+	case "SS", "NS", "BS":
+		return len(elements(av)), true
+	case "L":
+		return len(av.L), true
+	case "M":
+		return len(av.M), true
+	}
+	return 0, false
+}
+
+// formatNumber formats n as a decimal number.
+func formatNumber(n *big.Rat) string {
+	if n.IsInt() {
+		return n.Num().String()
+	}
+	// DynamoDB numbers have up to 38 digits of precision
+	return strings.TrimRight(n.FloatString(38), "0")
+}
@@ -0,0 +1,256 @@
+package dynamotest
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+)
+
+// Streams is an in-memory DynamoDB Streams client that reads the changes
+// made to tables of a DB created with a stream specification.
+// Each stream has a single open shard that holds every record.
+// Methods that aren't implemented panic.
+type Streams struct {
+	dynamodbstreamsiface.DynamoDBStreamsAPI
+
+	db *DB
+}
+
+var _ dynamodbstreamsiface.DynamoDBStreamsAPI = (*Streams)(nil)
+
+// Streams returns a DynamoDB Streams client for db.
+func (db *DB) Streams() *Streams {
+	return &Streams{db: db}
+}
+
+// shardID is the ID of every stream's only shard.
+const shardID = "shardId-00000000000000000000-00000001"
+
+type stream struct {
+	arn     string
+	table   string
+	label   string
+	view    string
+	keys    []*dynamodb.KeySchemaElement
+	records []*dynamodbstreams.Record
+}
+
+// enableStream creates the stream for t if spec enables it.
+func (db *DB) enableStream(t *table, spec *dynamodb.StreamSpecification) {
+	if spec == nil || !aws.BoolValue(spec.StreamEnabled) {
+		return
+	}
+	label := time.Now().UTC().Format("2006-01-02T15:04:05.000")
+	s := &stream{
+		arn:   aws.StringValue(t.desc.TableArn) + "/stream/" + label,
+		table: aws.StringValue(t.desc.TableName),
+		label: label,
+		view:  aws.StringValue(spec.StreamViewType),
+		keys:  t.desc.KeySchema,
+	}
+	t.stream = s
+	t.desc.StreamSpecification = spec
+	t.desc.LatestStreamArn = aws.String(s.arn)
+	t.desc.LatestStreamLabel = aws.String(s.label)
+	db.streams[s.arn] = s
+}
+
+// record appends a change from old to new to the table's stream, if it has one.
+// Puts that don't change the item aren't recorded.
+func (t *table) record(old, new item) {
+	s := t.stream
+	if s == nil || reflect.DeepEqual(old, new) {
+		return
+	}
+
+	changed := new
+	name := dynamodbstreams.OperationTypeModify
+	switch {
+	case old == nil:
+		name = dynamodbstreams.OperationTypeInsert
+	case new == nil:
+		name = dynamodbstreams.OperationTypeRemove
+		changed = old
+	}
+	keys := make(item)
+	for _, ks := range s.keys {
+		attr := aws.StringValue(ks.AttributeName)
+		keys[attr] = changed[attr]
+	}
+
+	seq := fmt.Sprintf("%021d", len(s.records)+1)
+	rec := &dynamodbstreams.StreamRecord{
+		ApproximateCreationDateTime: aws.Time(time.Now()),
+		Keys:                        clone(keys),
+		SequenceNumber:              aws.String(seq),
+		StreamViewType:              aws.String(s.view),
+	}
+	switch s.view {
+	case dynamodb.StreamViewTypeNewImage:
+		rec.NewImage = clone(new)
+	case dynamodb.StreamViewTypeOldImage:
+		rec.OldImage = clone(old)
+	case dynamodb.StreamViewTypeNewAndOldImages:
+		rec.NewImage = clone(new)
+		rec.OldImage = clone(old)
+	}
+	s.records = append(s.records, &dynamodbstreams.Record{
+		AwsRegion:    aws.String("local"),
+		Dynamodb:     rec,
+		EventID:      aws.String(seq),
+		EventName:    aws.String(name),
+		EventSource:  aws.String("aws:dynamodb"),
+		EventVersion: aws.String("1.1"),
+	})
+}
+
+func (s *Streams) stream(arn *string) (*stream, error) {
+	st, ok := s.db.streams[aws.StringValue(arn)]
+	if !ok {
+		return nil, awserr.New(dynamodbstreams.ErrCodeResourceNotFoundException, "Requested resource not found: Stream: "+aws.StringValue(arn)+" not found", nil)
+	}
+	return st, nil
+}
+
+func (s *Streams) ListStreamsWithContext(_ aws.Context, input *dynamodbstreams.ListStreamsInput, _ ...request.Option) (*dynamodbstreams.ListStreamsOutput, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	output := &dynamodbstreams.ListStreamsOutput{Streams: []*dynamodbstreams.Stream{}}
+	for _, st := range s.db.streams {
+		if input.TableName != nil && *input.TableName != st.table {
+			continue
+		}
+		output.Streams = append(output.Streams, &dynamodbstreams.Stream{
+			StreamArn:   aws.String(st.arn),
+			StreamLabel: aws.String(st.label),
+			TableName:   aws.String(st.table),
+		})
+	}
+	return output, nil
+}
+
+func (s *Streams) DescribeStreamWithContext(_ aws.Context, input *dynamodbstreams.DescribeStreamInput, _ ...request.Option) (*dynamodbstreams.DescribeStreamOutput, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	st, err := s.stream(input.StreamArn)
+	if err != nil {
+		return nil, err
+	}
+	desc := &dynamodbstreams.StreamDescription{
+		KeySchema:      st.keys,
+		Shards:         []*dynamodbstreams.Shard{},
+		StreamArn:      aws.String(st.arn),
+		StreamLabel:    aws.String(st.label),
+		StreamStatus:   aws.String(dynamodbstreams.StreamStatusEnabled),
+		StreamViewType: aws.String(st.view),
+		TableName:      aws.String(st.table),
+	}
+	if aws.StringValue(input.ExclusiveStartShardId) != shardID {
+		desc.Shards = append(desc.Shards, &dynamodbstreams.Shard{
+			ShardId: aws.String(shardID),
+			SequenceNumberRange: &dynamodbstreams.SequenceNumberRange{
+				StartingSequenceNumber: aws.String(fmt.Sprintf("%021d", 1)),
+			},
+		})
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: desc}, nil
+}
+
+func (s *Streams) GetShardIteratorWithContext(_ aws.Context, input *dynamodbstreams.GetShardIteratorInput, _ ...request.Option) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	st, err := s.stream(input.StreamArn)
+	if err != nil {
+		return nil, err
+	}
+	if *input.ShardId != shardID {
+		return nil, awserr.New(dynamodbstreams.ErrCodeResourceNotFoundException, "Requested resource not found: Shard does not exist", nil)
+	}
+
+	var pos int
+	switch typ := *input.ShardIteratorType; typ {
+	case dynamodbstreams.ShardIteratorTypeTrimHorizon:
+		pos = 0
+	case dynamodbstreams.ShardIteratorTypeLatest:
+		pos = len(st.records)
+	case dynamodbstreams.ShardIteratorTypeAtSequenceNumber, dynamodbstreams.ShardIteratorTypeAfterSequenceNumber:
+		seq, err := strconv.Atoi(aws.StringValue(input.SequenceNumber))
+		if err != nil || seq < 1 || seq > len(st.records) {
+			return nil, validationError("Invalid SequenceNumber: %s", aws.StringValue(input.SequenceNumber))
+		}
+		pos = seq - 1
+		if typ == dynamodbstreams.ShardIteratorTypeAfterSequenceNumber {
+			pos = seq
+		}
+	default:
+		return nil, validationError("Invalid ShardIteratorType: %s", typ)
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: shardIterator(st, pos)}, nil
+}
+
+func (s *Streams) GetRecordsWithContext(_ aws.Context, input *dynamodbstreams.GetRecordsInput, _ ...request.Option) (*dynamodbstreams.GetRecordsOutput, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	iter := aws.StringValue(input.ShardIterator)
+	i := strings.LastIndexByte(iter, '|')
+	if i < 0 {
+		return nil, validationError("Invalid ShardIterator")
+	}
+	st, err := s.stream(aws.String(iter[:i]))
+	if err != nil {
+		return nil, err
+	}
+	pos, err := strconv.Atoi(iter[i+1:])
+	if err != nil || pos < 0 || pos > len(st.records) {
+		return nil, validationError("Invalid ShardIterator")
+	}
+
+	n := int(aws.Int64Value(input.Limit))
+	if n <= 0 || n > 1000 {
+		n = 1000
+	}
+	end := pos + n
+	if end > len(st.records) {
+		end = len(st.records)
+	}
+	records := make([]*dynamodbstreams.Record, 0, end-pos)
+	for _, rec := range st.records[pos:end] {
+		records = append(records, copyRecord(rec))
+	}
+	// the shard is always open, so there is always a next iterator
+	return &dynamodbstreams.GetRecordsOutput{
+		Records:           records,
+		NextShardIterator: shardIterator(st, end),
+	}, nil
+}
+
+func shardIterator(st *stream, pos int) *string {
+	return aws.String(st.arn + "|" + strconv.Itoa(pos))
+}
+
+func copyRecord(rec *dynamodbstreams.Record) *dynamodbstreams.Record {
+	cp := *rec
+	sr := *rec.Dynamodb
+	sr.Keys = clone(sr.Keys)
+	sr.NewImage = clone(sr.NewImage)
+	sr.OldImage = clone(sr.OldImage)
+	cp.Dynamodb = &sr
+	return &cp
+}
@@ -0,0 +1,125 @@
+package dynamodb
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ichiban/prolog/engine"
+)
+
+// isConditionFailed returns true if err is the result of a failed condition expression.
+func isConditionFailed(err error) bool {
+	var ae awserr.Error
+	if errors.As(err, &ae) {
+		return ae.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+	}
+	return false
+}
+
+// throw returns a promise that throws err, converted with exception.
+func throw(err error, table string, env *engine.Env) *engine.Promise {
+	return engine.Error(exception(err, table, env))
+}
+
+// exception converts an error returned by DynamoDB into a Prolog exception:
+//   - throttling errors become error(resource_error(throughput), dynamodb_error(Code, Message))
+//   - if table isn't "", a missing table becomes error(existence_error(table, Table), dynamodb_error(resource_not_found, Message))
+//   - other DynamoDB errors become error(dynamodb_error(Code, Message), _)
+//   - requests that ran out of time, such as with the timeout(Ms) option, throw time_limit_exceeded
+//   - malformed lines of an import become error(syntax_error(Message), _)
+//   - any other error becomes error(system_error, Message)
+//
+// Code is the snake case error code, such as conditional_check_failed.
+// Exceptions are returned as-is.
+func exception(err error, table string, env *engine.Env) error {
+	var ex engine.Exception
+	if errors.As(err, &ex) {
+		return ex
+	}
+	if isTimeout(err) {
+		return engine.NewException(engine.Atom("time_limit_exceeded"), env)
+	}
+	var le *lineError
+	if errors.As(err, &le) {
+		return engine.SyntaxError(le, env)
+	}
+	var ae awserr.Error
+	if !errors.As(err, &ae) {
+		return engine.SystemError(err)
+	}
+
+	code := engine.Atom(errorCode(ae.Code()))
+	var formal engine.Term
+	switch ae.Code() {
+	case dynamodb.ErrCodeProvisionedThroughputExceededException, dynamodb.ErrCodeRequestLimitExceeded, "ThrottlingException":
+		formal = engine.Atom("resource_error").Apply(engine.Atom("throughput"))
+	case dynamodb.ErrCodeResourceNotFoundException:
+		if table == "" {
+			return dynamoError(code, err, env)
+		}
+		formal = engine.Atom("existence_error").Apply(engine.Atom("table"), engine.Atom(table))
+	default:
+		return dynamoError(code, err, env)
+	}
+	return engine.NewException(engine.Atom("error").Apply(
+		formal,
+		engine.Atom("dynamodb_error").Apply(code, engine.Atom(ae.Message())),
+	), env)
+}
+
+// dynamoError returns an exception in the form error(dynamodb_error(Code, Message), _).
+func dynamoError(code engine.Atom, err error, env *engine.Env) engine.Exception {
+	msg := err.Error()
+	var ae awserr.Error
+	if errors.As(err, &ae) {
+		msg = ae.Message()
+	}
+	return engine.NewException(engine.Atom("error").Apply(
+		engine.Atom("dynamodb_error").Apply(code, engine.Atom(msg)),
+		engine.NewVariable(),
+	), env)
+}
+
+// cancellationReasons converts the reasons for a canceled transaction into a list of reason(N, Op, Code, Message),
+// skipping operations that didn't cause the cancellation. Ops are the operations of the transaction, in order.
+func cancellationReasons(err error, ops []engine.Term) (engine.Term, bool) {
+	var tce *dynamodb.TransactionCanceledException
+	if !errors.As(err, &tce) {
+		return nil, false
+	}
+	reasons := make([]engine.Term, 0, len(tce.CancellationReasons))
+	for i, reason := range tce.CancellationReasons {
+		code := aws.StringValue(reason.Code)
+		if code == "None" || i >= len(ops) {
+			continue
+		}
+		reasons = append(reasons, engine.Atom("reason").Apply(
+			engine.Integer(i+1),
+			ops[i],
+			engine.Atom(errorCode(code)),
+			engine.Atom(aws.StringValue(reason.Message)),
+		))
+	}
+	return engine.List(reasons...), true
+}
+
+// errorCode converts a DynamoDB error code such as ConditionalCheckFailed or
+// ConditionalCheckFailedException into snake case: conditional_check_failed.
+func errorCode(code string) string {
+	code = strings.TrimSuffix(code, "Exception")
+	var sb strings.Builder
+	for i, r := range code {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,160 @@
+package dynamodb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// CreateFS is a file system that can also create files, needed by export_table/2.
+type CreateFS interface {
+	fs.FS
+	// Create creates or truncates the named file.
+	Create(name string) (io.WriteCloser, error)
+}
+
+// DirFS returns a file system for the directory dir, like os.DirFS, that can also create files.
+func DirFS(dir string) CreateFS {
+	return dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (fsys dirFS) Create(name string) (io.WriteCloser, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Create(filepath.Join(fsys.dir, filepath.FromSlash(name)))
+}
+
+// maxLine is the longest line ImportTable can read.
+// Items are at most 400KB, but binary values grow by a third when base64 encoded.
+const maxLine = 1 << 20
+
+// importBatch is the number of items ImportTable writes at a time.
+const importBatch = 25
+
+// lineError is a malformed line of an import.
+type lineError struct {
+	line int
+	err  error
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+func (e *lineError) Unwrap() error {
+	return e.err
+}
+
+// exportLine is a line of an export, the same format as DynamoDB's export to S3.
+type exportLine struct {
+	Item json.RawMessage
+}
+
+// ExportTable writes every item of table to w as JSON Lines in DynamoDB JSON format:
+//
+//	{"Item":{"UserID":{"N":"42"},"Tags":{"SS":["a","b"]}}}
+//
+// This is the same format as DynamoDB's export to S3. It returns the number of items written.
+func (d Dynamo) ExportTable(ctx context.Context, table string, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	iter := d.db.Table(table).Scan().Iter()
+	n := 0
+	var item map[string]*dynamodb.AttributeValue
+	for iter.NextWithContext(ctx, &item) {
+		data, err := marshalItem(item)
+		if err != nil {
+			return n, err
+		}
+		line, err := json.Marshal(exportLine{Item: data})
+		if err != nil {
+			return n, err
+		}
+		if _, err := bw.Write(append(line, '\n')); err != nil {
+			return n, err
+		}
+		n++
+		item = nil
+	}
+	if err := iter.Err(); err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// ImportTable puts every item read from r, in the format written by ExportTable, into table.
+// Items are written in batches, replacing existing items with the same key. Other items are left as-is.
+// It returns the number of items written.
+func (d Dynamo) ImportTable(ctx context.Context, table string, r io.Reader) (int, error) {
+	schema, err := d.schema(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	batch := d.db.Table(table).Batch(schema.pk, schema.sk)
+	if schema.sk == "" {
+		batch = d.db.Table(table).Batch(schema.pk)
+	}
+
+	n := 0
+	var items []interface{}
+	var writes []cachedWrite
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+		_, err := batch.Write().Put(items...).RunWithContext(ctx)
+		d.cache.written(writes)
+		if err != nil {
+			return err
+		}
+		n += len(items)
+		items, writes = items[:0], writes[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line exportLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return n, &lineError{line: lineno, err: err}
+		}
+		if line.Item == nil {
+			return n, &lineError{line: lineno, err: errors.New("missing Item")}
+		}
+		item, err := unmarshalItem(line.Item)
+		if err != nil {
+			return n, &lineError{line: lineno, err: err}
+		}
+		if err := d.validate(table, item, nil); err != nil {
+			return n, &lineError{line: lineno, err: err}
+		}
+		items = append(items, item)
+		writes = append(writes, cachedWrite{table: table, item: item})
+		if len(items) == importBatch {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
@@ -0,0 +1,471 @@
+package dynamodb
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+	"github.com/ichiban/prolog/engine"
+)
+
+// keyQuery builds a query for the key condition t, which is in pk-V or pk-V-&-SortCond form.
+// If schema is not nil, it is used to convert plain values.
+func keyQuery(table dynamo.Table, schema *tableSchema, t engine.Term, env *engine.Env) (*dynamo.Query, error) {
+	pk, rk, err := splitkeys(env.Resolve(t), env)
+	if err != nil {
+		return nil, err
+	}
+
+	pkName, pkValue, err := splitkey(env.Resolve(pk), env)
+	if err != nil {
+		return nil, err
+	}
+	pv, err := schema.value(pkName, pkValue, env)
+	if err != nil {
+		return nil, err
+	}
+	q := table.Get(pkName, pv)
+
+	if rk != nil {
+		name, op, values, err := parserange(rk, schema, env)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			args = append(args, v)
+		}
+		q.Range(name, op, args...)
+	}
+
+	return q, nil
+}
+
+// parserange parses a sort key condition, one of:
+//
+//	sk-type(v)
+//	sk-between(type(lo), type(hi))
+//	sk-begins_with(type(prefix))
+//	sk = type(v)    (also <, =<, >, >=)
+func parserange(t engine.Term, schema *tableSchema, env *engine.Env) (string, dynamo.Operator, []*dynamodb.AttributeValue, error) {
+	switch t := env.Resolve(t).(type) {
+	case engine.Variable:
+		return "", "", nil, engine.InstantiationError(env)
+	case engine.Compound:
+		if t.Arity() != 2 {
+			break
+		}
+
+		var op dynamo.Operator
+		switch t.Functor() {
+		case "-":
+			op = dynamo.Equal
+		case "=":
+			op = dynamo.Equal
+		case "<":
+			op = dynamo.Less
+		case "=<":
+			op = dynamo.LessOrEqual
+		case ">":
+			op = dynamo.Greater
+		case ">=":
+			op = dynamo.GreaterOrEqual
+		default:
+			return "", "", nil, engine.TypeError(engine.ValidTypePair, t, env)
+		}
+
+		var name string
+		switch key := env.Resolve(t.Arg(0)).(type) {
+		case engine.Atom:
+			name = string(key)
+		case engine.Variable:
+			return "", "", nil, engine.InstantiationError(env)
+		default:
+			return "", "", nil, engine.TypeError(engine.ValidTypeAtom, key, env)
+		}
+
+		operand := env.Resolve(t.Arg(1))
+		if cmp, ok := operand.(engine.Compound); ok && t.Functor() == "-" {
+			switch {
+			case cmp.Functor() == "between" && cmp.Arity() == 2:
+				lo, err := schema.value(name, cmp.Arg(0), env)
+				if err != nil {
+					return "", "", nil, err
+				}
+				hi, err := schema.value(name, cmp.Arg(1), env)
+				if err != nil {
+					return "", "", nil, err
+				}
+				return name, dynamo.Between, []*dynamodb.AttributeValue{lo, hi}, nil
+			case cmp.Functor() == "begins_with" && cmp.Arity() == 1:
+				prefix, err := schema.value(name, cmp.Arg(0), env)
+				if err != nil {
+					return "", "", nil, err
+				}
+				return name, dynamo.BeginsWith, []*dynamodb.AttributeValue{prefix}, nil
+			}
+		}
+
+		av, err := schema.value(name, operand, env)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return name, op, []*dynamodb.AttributeValue{av}, nil
+	}
+	return "", "", nil, engine.TypeError(engine.ValidTypePair, t, env)
+}
+
+// itemKey is the primary key of a single item.
+// sk is empty for tables without a sort key.
+type itemKey struct {
+	pk, sk string
+	pv, sv *dynamodb.AttributeValue
+}
+
+// keyed returns the key's values for use with dynamo.Batch.
+func (key itemKey) keyed() dynamo.Keyed {
+	if key.sk == "" {
+		return dynamo.Keys{key.pv, nil}
+	}
+	return dynamo.Keys{key.pv, key.sv}
+}
+
+// String returns a string uniquely identifying this key's values.
+// Numbers are normalized, so n('1.0') and n('01') identify the same item as n(1), like DynamoDB does.
+func (key itemKey) String() string {
+	if key.sk == "" {
+		return keyValue(key.pv)
+	}
+	return keyValue(key.pv) + "\x00" + keyValue(key.sv)
+}
+
+// keyValue encodes the key attribute value av, normalizing numbers.
+func keyValue(av *dynamodb.AttributeValue) string {
+	switch {
+	case av == nil:
+		return ""
+	case av.S != nil:
+		return "S" + *av.S
+	case av.N != nil:
+		if r, ok := new(big.Rat).SetString(*av.N); ok {
+			return "N" + r.RatString()
+		}
+		return "N" + *av.N
+	case av.B != nil:
+		return "B" + string(av.B)
+	}
+	return av.String()
+}
+
+// condition compiles the Prolog condition t into a DynamoDB condition expression.
+// Attribute names and values are always substituted with placeholders.
+// Conditions are one of:
+//
+//	Attr = Value    (also \=, <, =<, >, >=)
+//	size(Attr) = Value    (and the other comparisons)
+//	between(Attr, Lo, Hi)
+//	in(Attr, Values)
+//	begins_with(Attr, Prefix)
+//	contains(Attr, Value)
+//	attribute_exists(Attr)
+//	attribute_not_exists(Attr)
+//	attribute_type(Attr, Type)
+//	and(Cond, Cond)
+//	or(Cond, Cond)
+//	not(Cond)
+func condition(t engine.Term, env *engine.Env) (dynamo.ExpressionLiteral, error) {
+	var c compiler
+	expr, err := c.condition(t, env)
+	if err != nil {
+		return dynamo.ExpressionLiteral{}, err
+	}
+	return c.literal(expr), nil
+}
+
+// compiler builds expressions with placeholders for names (#n0, #n1, ...) and values (:v0, :v1, ...).
+// A single compiler can be used for several expressions of the same request, such as a filter and a projection.
+type compiler struct {
+	expr   strings.Builder
+	names  map[string]*string
+	values map[string]*dynamodb.AttributeValue
+}
+
+// condition compiles t into a condition expression. See the condition function.
+func (c *compiler) condition(t engine.Term, env *engine.Env) (string, error) {
+	c.expr.Reset()
+	if err := c.compile(t, env); err != nil {
+		return "", err
+	}
+	return c.expr.String(), nil
+}
+
+// projection compiles a list of attribute names into a projection expression.
+func (c *compiler) projection(t engine.Term, env *engine.Env) (string, error) {
+	c.expr.Reset()
+	iter := engine.ListIterator{List: env.Resolve(t), Env: env}
+	for i := 0; iter.Next(); i++ {
+		if i > 0 {
+			c.expr.WriteString(", ")
+		}
+		if err := c.name(iter.Current(), env); err != nil {
+			return "", err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return "", err
+	}
+	return c.expr.String(), nil
+}
+
+// update compiles the list of update actions t into an update expression.
+// Actions are one of:
+//
+//	set(Path, Value)
+//	add(Path, Value)
+//	remove(Path)
+//	delete(Path, Set)
+//
+// Paths are attribute names and are substituted with placeholders like conditions,
+// so reserved words and names with dots, dashes, or spaces are used as-is.
+func (c *compiler) update(t engine.Term, env *engine.Env) (string, error) {
+	verbs := []string{"SET", "ADD", "DELETE", "REMOVE"}
+	clauses := make(map[string][]string, len(verbs))
+	iter := engine.ListIterator{List: env.Resolve(t), Env: env}
+	for iter.Next() {
+		var action engine.Compound
+		switch a := env.Resolve(iter.Current()).(type) {
+		case engine.Variable:
+			return "", engine.InstantiationError(env)
+		case engine.Compound:
+			action = a
+		default:
+			return "", engine.TypeError(engine.ValidTypeCompound, a, env)
+		}
+
+		c.expr.Reset()
+		if err := c.name(action.Arg(0), env); err != nil {
+			return "", err
+		}
+
+		switch {
+		case action.Functor() == "remove" && action.Arity() == 1:
+			clauses["REMOVE"] = append(clauses["REMOVE"], c.expr.String())
+			continue
+		case action.Arity() != 2:
+			return "", domainError("update_action", action, env)
+		}
+
+		value, err := prolog2av(action.Arg(1), env)
+		if err != nil {
+			return "", err
+		}
+		var verb string
+		switch action.Functor() {
+		case "set":
+			verb = "SET"
+			c.expr.WriteString(" = ")
+		case "add":
+			verb = "ADD"
+			c.expr.WriteString(" ")
+		case "delete":
+			verb = "DELETE"
+			c.expr.WriteString(" ")
+			value = setOf(value)
+		default:
+			return "", domainError("update_action", action, env)
+		}
+		c.placeholder(value)
+		clauses[verb] = append(clauses[verb], c.expr.String())
+	}
+	if err := iter.Err(); err != nil {
+		return "", err
+	}
+
+	var expr []string
+	for _, verb := range verbs {
+		if len(clauses[verb]) > 0 {
+			expr = append(expr, verb+" "+strings.Join(clauses[verb], ", "))
+		}
+	}
+	return strings.Join(expr, " "), nil
+}
+
+// setOf returns av as a set, so a single element can be deleted from a set as a set of one.
+// Other values are returned as-is.
+func setOf(av *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	switch {
+	case av.S != nil:
+		return &dynamodb.AttributeValue{SS: []*string{av.S}}
+	case av.N != nil:
+		return &dynamodb.AttributeValue{NS: []*string{av.N}}
+	case av.B != nil:
+		return &dynamodb.AttributeValue{BS: [][]byte{av.B}}
+	}
+	return av
+}
+
+func (c *compiler) literal(expr string) dynamo.ExpressionLiteral {
+	return dynamo.ExpressionLiteral{
+		Expression:      expr,
+		AttributeNames:  c.names,
+		AttributeValues: c.values,
+	}
+}
+
+var comparisons = map[engine.Atom]string{
+	"=":  "=",
+	`\=`: "<>",
+	"<":  "<",
+	"=<": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+func (c *compiler) compile(t engine.Term, env *engine.Env) error {
+	var cond engine.Compound
+	switch t := env.Resolve(t).(type) {
+	case engine.Variable:
+		return engine.InstantiationError(env)
+	case engine.Compound:
+		cond = t
+	default:
+		return domainError("condition", t, env)
+	}
+
+	functor, arity := cond.Functor(), cond.Arity()
+	if op, ok := comparisons[functor]; ok && arity == 2 {
+		if err := c.operand(cond.Arg(0), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(" " + op + " ")
+		return c.value(cond.Arg(1), env)
+	}
+
+	switch {
+	case functor == "and" && arity == 2, functor == "or" && arity == 2:
+		c.expr.WriteString("(")
+		if err := c.compile(cond.Arg(0), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(") " + strings.ToUpper(string(functor)) + " (")
+		if err := c.compile(cond.Arg(1), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(")")
+		return nil
+	case functor == "not" && arity == 1:
+		c.expr.WriteString("NOT (")
+		if err := c.compile(cond.Arg(0), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(")")
+		return nil
+	case functor == "between" && arity == 3:
+		if err := c.name(cond.Arg(0), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(" BETWEEN ")
+		if err := c.value(cond.Arg(1), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(" AND ")
+		return c.value(cond.Arg(2), env)
+	case functor == "in" && arity == 2:
+		if err := c.name(cond.Arg(0), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(" IN (")
+		iter := engine.ListIterator{List: cond.Arg(1), Env: env}
+		for i := 0; iter.Next(); i++ {
+			if i > 0 {
+				c.expr.WriteString(", ")
+			}
+			if err := c.value(iter.Current(), env); err != nil {
+				return err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+		c.expr.WriteString(")")
+		return nil
+	case functor == "begins_with" && arity == 2,
+		functor == "contains" && arity == 2,
+		functor == "attribute_type" && arity == 2:
+		c.expr.WriteString(string(functor) + "(")
+		if err := c.name(cond.Arg(0), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(", ")
+		if err := c.value(cond.Arg(1), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(")")
+		return nil
+	case functor == "attribute_exists" && arity == 1,
+		functor == "attribute_not_exists" && arity == 1:
+		c.expr.WriteString(string(functor) + "(")
+		if err := c.name(cond.Arg(0), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(")")
+		return nil
+	}
+
+	return domainError("condition", cond, env)
+}
+
+// operand is the left side of a comparison: an attribute name or size(Attr).
+func (c *compiler) operand(t engine.Term, env *engine.Env) error {
+	if size, ok := env.Resolve(t).(engine.Compound); ok && size.Functor() == "size" && size.Arity() == 1 {
+		c.expr.WriteString("size(")
+		if err := c.name(size.Arg(0), env); err != nil {
+			return err
+		}
+		c.expr.WriteString(")")
+		return nil
+	}
+	return c.name(t, env)
+}
+
+func (c *compiler) name(t engine.Term, env *engine.Env) error {
+	name, err := atomArg(t, env)
+	if err != nil {
+		return err
+	}
+	if c.names == nil {
+		c.names = make(map[string]*string)
+	}
+	placeholder := "#n" + strconv.Itoa(len(c.names))
+	for k, v := range c.names {
+		if *v == name {
+			placeholder = k
+			break
+		}
+	}
+	c.names[placeholder] = aws.String(name)
+	c.expr.WriteString(placeholder)
+	return nil
+}
+
+func (c *compiler) value(t engine.Term, env *engine.Env) error {
+	av, err := prolog2av(t, env)
+	if err != nil {
+		return err
+	}
+	c.placeholder(av)
+	return nil
+}
+
+// placeholder writes a new value placeholder for av.
+func (c *compiler) placeholder(av *dynamodb.AttributeValue) {
+	if c.values == nil {
+		c.values = make(map[string]*dynamodb.AttributeValue)
+	}
+	placeholder := ":v" + strconv.Itoa(len(c.values))
+	c.values[placeholder] = av
+	c.expr.WriteString(placeholder)
+}
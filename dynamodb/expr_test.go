@@ -0,0 +1,129 @@
+package dynamodb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/go-cmp/cmp"
+	"github.com/guregu/dynamo"
+	"github.com/ichiban/prolog/engine"
+
+	"github.com/guregu/predicates/internal"
+)
+
+func TestParseRange(t *testing.T) {
+	s := func(v string) engine.Term { return engine.Atom("s").Apply(engine.Atom(v)) }
+	sk := engine.Atom("sk")
+
+	tests := []struct {
+		name   string
+		term   engine.Term
+		op     dynamo.Operator
+		values []*dynamodb.AttributeValue
+	}{
+		{
+			name:   "pair",
+			term:   engine.Atom("-").Apply(sk, s("a")),
+			op:     dynamo.Equal,
+			values: []*dynamodb.AttributeValue{{S: aws.String("a")}},
+		},
+		{
+			name:   "greater or equal",
+			term:   engine.Atom(">=").Apply(sk, s("a")),
+			op:     dynamo.GreaterOrEqual,
+			values: []*dynamodb.AttributeValue{{S: aws.String("a")}},
+		},
+		{
+			name:   "less",
+			term:   engine.Atom("<").Apply(sk, engine.Atom("n").Apply(engine.Integer(3))),
+			op:     dynamo.Less,
+			values: []*dynamodb.AttributeValue{{N: aws.String("3")}},
+		},
+		{
+			name:   "between",
+			term:   engine.Atom("-").Apply(sk, engine.Atom("between").Apply(s("a"), s("z"))),
+			op:     dynamo.Between,
+			values: []*dynamodb.AttributeValue{{S: aws.String("a")}, {S: aws.String("z")}},
+		},
+		{
+			name:   "begins_with",
+			term:   engine.Atom("-").Apply(sk, engine.Atom("begins_with").Apply(s("2022-"))),
+			op:     dynamo.BeginsWith,
+			values: []*dynamodb.AttributeValue{{S: aws.String("2022-")}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name, op, values, err := parserange(test.term, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != "sk" {
+				t.Error("bad name. want: sk got:", name)
+			}
+			if op != test.op {
+				t.Error("bad op. want:", test.op, "got:", op)
+			}
+			if diff := cmp.Diff(test.values, values); diff != "" {
+				t.Error("values mismatch (-want +got):\n", diff)
+			}
+		})
+	}
+
+	t.Run("unknown operator", func(t *testing.T) {
+		_, _, _, err := parserange(engine.Atom("\\=").Apply(sk, s("a")), nil, nil)
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestCondition(t *testing.T) {
+	p := internal.NewTestProlog()
+	tests := []struct {
+		cond   string
+		expr   string
+		names  int
+		values int
+	}{
+		{"version = n(3)", "#n0 = :v0", 1, 1},
+		{`a \= s(x)`, "#n0 <> :v0", 1, 1},
+		{"size(tags) > 3", "size(#n0) > :v0", 1, 1},
+		{"attribute_not_exists('UserID')", "attribute_not_exists(#n0)", 1, 0},
+		{"between(n, 1, 10)", "#n0 BETWEEN :v0 AND :v1", 1, 2},
+		{"in(color, [red, blue])", "#n0 IN (:v0, :v1)", 1, 2},
+		{"begins_with(name, s(abc))", "begins_with(#n0, :v0)", 1, 1},
+		{"and(a = 1, or(b = 2, not(attribute_exists(a))))", "(#n0 = :v0) AND ((#n1 = :v1) OR (NOT (attribute_exists(#n0))))", 2, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.cond, func(t *testing.T) {
+			term, err := p.Parser(strings.NewReader(test.cond+"."), nil).Term()
+			if err != nil {
+				t.Fatal(err)
+			}
+			lit, err := condition(term, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lit.Expression != test.expr {
+				t.Error("bad expression. want:", test.expr, "got:", lit.Expression)
+			}
+			if len(lit.AttributeNames) != test.names {
+				t.Error("bad number of names. want:", test.names, "got:", len(lit.AttributeNames))
+			}
+			if len(lit.AttributeValues) != test.values {
+				t.Error("bad number of values. want:", test.values, "got:", len(lit.AttributeValues))
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := condition(engine.Atom("frob").Apply(engine.Atom("x")), nil)
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+}
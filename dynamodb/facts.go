@@ -0,0 +1,191 @@
+package dynamodb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+	"github.com/ichiban/prolog/engine"
+)
+
+// factTables holds the predicates defined with dynamo_table/3.
+type factTables struct {
+	mu     sync.Mutex
+	tables map[engine.ProcedureIndicator]factTable
+}
+
+// factTable is the table and attributes behind a predicate defined with dynamo_table/3.
+type factTable struct {
+	// connection name, empty for the default connection
+	conn  string
+	table string
+	attrs []string
+}
+
+func newFactTables() *factTables {
+	return &factTables{tables: make(map[engine.ProcedureIndicator]factTable)}
+}
+
+// lookup returns the table behind the predicate of fact, or throws error(existence_error(dynamo_table, Name/Arity), _).
+func (ft *factTables) lookup(fact engine.Term, env *engine.Env) (factTable, []engine.Term, error) {
+	var name engine.Atom
+	var args []engine.Term
+	switch f := env.Resolve(fact).(type) {
+	case engine.Variable:
+		return factTable{}, nil, engine.InstantiationError(env)
+	case engine.Atom:
+		name = f
+	case engine.Compound:
+		name = f.Functor()
+		args = make([]engine.Term, f.Arity())
+		for i := range args {
+			args[i] = f.Arg(i)
+		}
+	default:
+		return factTable{}, nil, engine.TypeError(engine.ValidTypeCallable, f, env)
+	}
+
+	pi := engine.ProcedureIndicator{Name: name, Arity: engine.Integer(len(args))}
+	ft.mu.Lock()
+	t, ok := ft.tables[pi]
+	ft.mu.Unlock()
+	if !ok {
+		return factTable{}, nil, existenceError("dynamo_table", pi.Term(), env)
+	}
+	return t, args, nil
+}
+
+// attrNames parses a list of attribute names.
+func attrNames(t engine.Term, env *engine.Env) ([]string, error) {
+	var attrs []string
+	iter := engine.ListIterator{List: env.Resolve(t), Env: env}
+	for iter.Next() {
+		attr, err := atomArg(iter.Current(), env)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, iter.Err()
+}
+
+// defineTable ('$dynamo_table'/3) records the table behind the predicate PI for dynamo_assert/1 and dynamo_retract/1.
+// It's called by dynamo_table/3, which defines the predicate itself.
+//
+//	'$dynamo_table'(+PI, +Table, +Attrs).
+func (d Dynamo) defineTable(pi, table, attrs engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	key, err := engine.NewProcedureIndicator(pi, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	conn, from, err := d.resolve(table, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	names, err := attrNames(attrs, env)
+	if err != nil {
+		return engine.Error(err)
+	}
+	if len(names) != int(key.Arity) {
+		return engine.Error(domainError("dynamo_table_attributes", attrs, env))
+	}
+	d.facts.mu.Lock()
+	d.facts.tables[key] = factTable{conn: conn.name, table: from, attrs: names}
+	d.facts.mu.Unlock()
+	return k(env)
+}
+
+// eachFact calls fn lazily for every item of table that might match args, the values of attrs.
+// If args has the table's partition and sort key, it gets that item. If it only has the partition key,
+// it queries the partition. Otherwise, it scans the table.
+// Key values that can't be converted to the key's type don't match any item.
+func (d Dynamo) eachFact(ctx context.Context, table string, attrs []string, args []engine.Term, fn func(map[string]*dynamodb.AttributeValue) *engine.Promise, env *engine.Env) *engine.Promise {
+	s, err := d.schema(ctx, table)
+	if err != nil {
+		return throw(err, table, env)
+	}
+	// bound returns the value of attr in args if it's there and bound, and false if it can't be converted
+	bound := func(attr string) (av *dynamodb.AttributeValue, has bool, ok bool) {
+		for i, name := range attrs {
+			if name != attr || attr == "" {
+				continue
+			}
+			if _, ok := env.Resolve(args[i]).(engine.Variable); ok {
+				return nil, false, true
+			}
+			av, err := s.value(attr, args[i], env)
+			return av, true, err == nil
+		}
+		return nil, false, true
+	}
+
+	pv, hasPK, ok := bound(s.pk)
+	if !ok {
+		return engine.Bool(false)
+	}
+	sv, hasSK, ok := bound(s.sk)
+	if !ok {
+		return engine.Bool(false)
+	}
+
+	var iter dynamo.Iter
+	switch {
+	case hasPK && (hasSK || s.sk == ""):
+		item, err := d.get(ctx, table, itemKey{pk: s.pk, pv: pv, sk: s.sk, sv: sv}, false)
+		if err != nil {
+			return throw(err, table, env)
+		}
+		if item == nil {
+			return engine.Bool(false)
+		}
+		return fn(item)
+	case hasPK:
+		iter = d.db.Table(table).Get(s.pk, pv).Iter()
+	default:
+		iter = d.db.Table(table).Scan().Iter()
+	}
+
+	var next func(context.Context) *engine.Promise
+	next = func(ctx context.Context) *engine.Promise {
+		var item map[string]*dynamodb.AttributeValue
+		if !iter.NextWithContext(ctx, &item) {
+			if err := iter.Err(); err != nil {
+				return throw(err, table, env)
+			}
+			return engine.Bool(false)
+		}
+		return d.delay(func(context.Context) *engine.Promise {
+			return fn(item)
+		}, next)
+	}
+	return d.delay(next)
+}
+
+// factValues returns the plain values of attrs in item, as a list.
+// Missing attributes are null(true).
+func factValues(item map[string]*dynamodb.AttributeValue, attrs []string) (engine.Term, error) {
+	values := make([]engine.Term, 0, len(attrs))
+	for _, attr := range attrs {
+		av, ok := item[attr]
+		if !ok {
+			values = append(values, engine.Atom("null").Apply(engine.Atom("true")))
+			continue
+		}
+		v, err := simplify(av2prolog(av), nil)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return engine.List(values...), nil
+}
+
+// freshArgs returns a list of n new variables.
+func freshArgs(n int) []engine.Term {
+	args := make([]engine.Term, n)
+	for i := range args {
+		args[i] = engine.NewVariable()
+	}
+	return args
+}
@@ -0,0 +1,337 @@
+package dynamodb
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/guregu/dynamo"
+	"github.com/ichiban/prolog/engine"
+)
+
+// Metric is a request made to DynamoDB, as passed to the callback given to WithMetrics.
+type Metric struct {
+	// Predicate is the predicate that made the request, such as get_item/3.
+	Predicate string
+	// Operation is the DynamoDB API operation, such as GetItem or Query.
+	Operation string
+	// Capacity is the number of capacity units consumed by each table, as reported by DynamoDB.
+	Capacity map[string]float64
+	// Latency is how long the request took.
+	Latency time.Duration
+	// Err is the error returned by the request, if any.
+	Err error
+}
+
+// PredicateStats sums up the requests made by a predicate.
+type PredicateStats struct {
+	Requests int64
+	Errors   int64
+	// Capacity is the total number of capacity units consumed.
+	Capacity float64
+	// Tables is the number of capacity units consumed by each table.
+	Tables map[string]float64
+	// Latency is the total latency of every request.
+	Latency time.Duration
+}
+
+// metrics collects the requests of every predicate.
+type metrics struct {
+	fn func(Metric)
+
+	mu sync.Mutex
+	// by predicate indicator, such as get_item/3
+	stats map[string]*PredicateStats
+}
+
+func newMetrics(fn func(Metric)) *metrics {
+	return &metrics{fn: fn, stats: make(map[string]*PredicateStats)}
+}
+
+func (m *metrics) record(metric Metric) {
+	m.mu.Lock()
+	stats, ok := m.stats[metric.Predicate]
+	if !ok {
+		stats = &PredicateStats{Tables: make(map[string]float64)}
+		m.stats[metric.Predicate] = stats
+	}
+	stats.Requests++
+	if metric.Err != nil {
+		stats.Errors++
+	}
+	for table, units := range metric.Capacity {
+		stats.Capacity += units
+		stats.Tables[table] += units
+	}
+	stats.Latency += metric.Latency
+	m.mu.Unlock()
+
+	if m.fn != nil {
+		m.fn(metric)
+	}
+}
+
+func (m *metrics) snapshot() map[string]PredicateStats {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snap := make(map[string]PredicateStats, len(m.stats))
+	for pi, stats := range m.stats {
+		s := *stats
+		s.Tables = make(map[string]float64, len(stats.Tables))
+		for table, units := range stats.Tables {
+			s.Tables[table] = units
+		}
+		snap[pi] = s
+	}
+	return snap
+}
+
+// WithMetrics returns a copy of d that measures the consumed capacity and latency of every request made by its predicates,
+// including those made through other connections (see WithConnection).
+// Each request is passed to fn as it completes, unless fn is nil, and summed up by predicate for Stats and dynamo_stats/1.
+// fn may be called concurrently.
+//
+// Requests ask DynamoDB to return their total consumed capacity, unless they already set ReturnConsumedCapacity.
+// Requests that fetch several pages, such as query and scan, are measured once per page.
+// Predicates defined by dynamo_table/3 are counted as dynamo_fact/3.
+//
+// The client of d's DB is wrapped once, here. guregu/dynamo can't copy a DB's logger to a new client,
+// so the wrapped DB logs with the default logger.
+func (d Dynamo) WithMetrics(fn func(Metric)) Dynamo {
+	d.metrics = newMetrics(fn)
+	d.db = d.metrics.wrap(d.db)
+	if d.conns != nil {
+		conns := make(map[string]Dynamo, len(d.conns))
+		for name, conn := range d.conns {
+			conns[name] = conn.metered(d.metrics)
+		}
+		d.conns = conns
+	}
+	return d
+}
+
+// metered returns a copy of the connection d that reports its requests to m.
+func (d Dynamo) metered(m *metrics) Dynamo {
+	d.metrics = m
+	d.db = m.wrap(d.db)
+	return d
+}
+
+// Stats returns the requests made by each predicate, such as get_item/3, since WithMetrics was called.
+// It returns nil if metrics are disabled.
+func (d Dynamo) Stats() map[string]PredicateStats {
+	return d.metrics.snapshot()
+}
+
+// meter returns a copy of d whose requests, and those of its connections, are counted for the predicate pi.
+func (d Dynamo) meter(pi string) Dynamo {
+	d.pi = pi
+	return d
+}
+
+// delay is like engine.Delay, but requests made with the contexts passed to ks are counted for d's predicate.
+func (d Dynamo) delay(ks ...func(context.Context) *engine.Promise) *engine.Promise {
+	if d.metrics == nil {
+		return engine.Delay(ks...)
+	}
+	metered := make([]func(context.Context) *engine.Promise, len(ks))
+	for i, k := range ks {
+		k := k
+		metered[i] = func(ctx context.Context) *engine.Promise {
+			return k(context.WithValue(ctx, predicateKey{}, d.pi))
+		}
+	}
+	return engine.Delay(metered...)
+}
+
+// DynamoStats (dynamo_stats/1) unifies Stats with the requests made by each predicate since metrics were enabled (see WithMetrics),
+// as a list of PI-Info sorted by PI, where Info is a key-value list of
+// requests, errors, capacity (consumed capacity units), tables (Table-Capacity pairs), and latency_ms (total latency in milliseconds).
+// Stats is [] if metrics are disabled.
+//
+//	dynamo_stats(-Stats).
+func (d Dynamo) DynamoStats(stats engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	snap := d.Stats()
+	pis := make([]string, 0, len(snap))
+	for pi := range snap {
+		pis = append(pis, pi)
+	}
+	sort.Strings(pis)
+
+	list := make([]engine.Term, 0, len(pis))
+	for _, pi := range pis {
+		s := snap[pi]
+		tables := make([]string, 0, len(s.Tables))
+		for table := range s.Tables {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		caps := make([]engine.Term, 0, len(tables))
+		for _, table := range tables {
+			caps = append(caps, pair(table, engine.Float(s.Tables[table])))
+		}
+		info := engine.List(
+			pair("requests", engine.Integer(s.Requests)),
+			pair("errors", engine.Integer(s.Errors)),
+			pair("capacity", engine.Float(s.Capacity)),
+			pair("tables", engine.List(caps...)),
+			pair("latency_ms", engine.Float(float64(s.Latency)/float64(time.Millisecond))),
+		)
+		list = append(list, engine.Atom("-").Apply(piTerm(pi), info))
+	}
+	return engine.Unify(stats, engine.List(list...), k, env)
+}
+
+// piTerm converts a predicate indicator such as get_item/3 to a term.
+func piTerm(pi string) engine.Term {
+	i := strings.LastIndexByte(pi, '/')
+	arity, _ := strconv.Atoi(pi[i+1:])
+	return engine.Atom("/").Apply(engine.Atom(pi[:i]), engine.Integer(arity))
+}
+
+// meteredClient is a DynamoDB client that reports the consumed capacity and latency of item requests to metrics.
+// Other requests, such as creating tables, aren't measured.
+// Requests are counted for the predicate found in their context (see Dynamo.delay).
+type meteredClient struct {
+	dynamodbiface.DynamoDBAPI
+	metrics *metrics
+}
+
+// wrap returns a DB that reports the requests of db to m.
+// A DB that already reports to other metrics is unwrapped first, so requests are never counted twice.
+func (m *metrics) wrap(db *dynamo.DB) *dynamo.DB {
+	client := db.Client()
+	if mc, ok := client.(*meteredClient); ok {
+		client = mc.DynamoDBAPI
+	}
+	return dynamo.NewFromIface(&meteredClient{DynamoDBAPI: client, metrics: m})
+}
+
+// predicateKey is the context key for the predicate indicator of a request.
+type predicateKey struct{}
+
+// predicate returns the predicate indicator that ctx was made for, such as get_item/3.
+func predicate(ctx context.Context) string {
+	pi, _ := ctx.Value(predicateKey{}).(string)
+	return pi
+}
+
+// returnCapacity asks for the total consumed capacity, unless mode is already set.
+func returnCapacity(mode **string) {
+	if *mode == nil {
+		*mode = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	}
+}
+
+func (c *meteredClient) record(ctx aws.Context, op string, start time.Time, err error, ccs ...*dynamodb.ConsumedCapacity) {
+	capacity := make(map[string]float64, len(ccs))
+	for _, cc := range ccs {
+		if cc == nil {
+			continue
+		}
+		capacity[aws.StringValue(cc.TableName)] += aws.Float64Value(cc.CapacityUnits)
+	}
+	c.metrics.record(Metric{
+		Predicate: predicate(ctx),
+		Operation: op,
+		Capacity:  capacity,
+		Latency:   time.Since(start),
+		Err:       err,
+	})
+}
+
+// meter sends a request with send and reports it to c's metrics as the operation op,
+// asking for the consumed capacity with mode if the request didn't already.
+// capacity returns the consumed capacity of a response.
+func meter[I, O any](c *meteredClient, ctx aws.Context, op string, mode **string, input I, opts []request.Option,
+	send func(aws.Context, I, ...request.Option) (*O, error), capacity func(*O) []*dynamodb.ConsumedCapacity) (*O, error) {
+	returnCapacity(mode)
+	start := time.Now()
+	out, err := send(ctx, input, opts...)
+	var ccs []*dynamodb.ConsumedCapacity
+	if out != nil {
+		ccs = capacity(out)
+	}
+	c.record(ctx, op, start, err, ccs...)
+	return out, err
+}
+
+func (c *meteredClient) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return meter(c, ctx, "GetItem", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.GetItemWithContext,
+		func(out *dynamodb.GetItemOutput) []*dynamodb.ConsumedCapacity {
+			return []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+		})
+}
+
+func (c *meteredClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	return meter(c, ctx, "PutItem", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.PutItemWithContext,
+		func(out *dynamodb.PutItemOutput) []*dynamodb.ConsumedCapacity {
+			return []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+		})
+}
+
+func (c *meteredClient) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	return meter(c, ctx, "UpdateItem", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.UpdateItemWithContext,
+		func(out *dynamodb.UpdateItemOutput) []*dynamodb.ConsumedCapacity {
+			return []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+		})
+}
+
+func (c *meteredClient) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	return meter(c, ctx, "DeleteItem", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.DeleteItemWithContext,
+		func(out *dynamodb.DeleteItemOutput) []*dynamodb.ConsumedCapacity {
+			return []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+		})
+}
+
+func (c *meteredClient) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	return meter(c, ctx, "Query", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.QueryWithContext,
+		func(out *dynamodb.QueryOutput) []*dynamodb.ConsumedCapacity {
+			return []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+		})
+}
+
+func (c *meteredClient) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	return meter(c, ctx, "Scan", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.ScanWithContext,
+		func(out *dynamodb.ScanOutput) []*dynamodb.ConsumedCapacity {
+			return []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+		})
+}
+
+func (c *meteredClient) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	return meter(c, ctx, "BatchGetItem", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.BatchGetItemWithContext,
+		func(out *dynamodb.BatchGetItemOutput) []*dynamodb.ConsumedCapacity { return out.ConsumedCapacity })
+}
+
+func (c *meteredClient) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	return meter(c, ctx, "BatchWriteItem", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.BatchWriteItemWithContext,
+		func(out *dynamodb.BatchWriteItemOutput) []*dynamodb.ConsumedCapacity { return out.ConsumedCapacity })
+}
+
+func (c *meteredClient) TransactGetItemsWithContext(ctx aws.Context, input *dynamodb.TransactGetItemsInput, opts ...request.Option) (*dynamodb.TransactGetItemsOutput, error) {
+	return meter(c, ctx, "TransactGetItems", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.TransactGetItemsWithContext,
+		func(out *dynamodb.TransactGetItemsOutput) []*dynamodb.ConsumedCapacity { return out.ConsumedCapacity })
+}
+
+func (c *meteredClient) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	return meter(c, ctx, "TransactWriteItems", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.TransactWriteItemsWithContext,
+		func(out *dynamodb.TransactWriteItemsOutput) []*dynamodb.ConsumedCapacity { return out.ConsumedCapacity })
+}
+
+func (c *meteredClient) ExecuteStatementWithContext(ctx aws.Context, input *dynamodb.ExecuteStatementInput, opts ...request.Option) (*dynamodb.ExecuteStatementOutput, error) {
+	return meter(c, ctx, "ExecuteStatement", &input.ReturnConsumedCapacity, input, opts, c.DynamoDBAPI.ExecuteStatementWithContext,
+		func(out *dynamodb.ExecuteStatementOutput) []*dynamodb.ConsumedCapacity {
+			return []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+		})
+}
@@ -0,0 +1,188 @@
+package dynamodb
+
+import (
+	"strings"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/ichiban/prolog/engine"
+)
+
+// eachOption calls fn for every option in the list opts.
+// Options must be compound terms such as limit(10).
+func eachOption(opts engine.Term, env *engine.Env, fn func(opt engine.Compound) error) error {
+	iter := engine.ListIterator{List: env.Resolve(opts), Env: env}
+	for iter.Next() {
+		switch opt := env.Resolve(iter.Current()).(type) {
+		case engine.Variable:
+			return engine.InstantiationError(env)
+		case engine.Compound:
+			if err := fn(opt); err != nil {
+				return err
+			}
+		default:
+			return engine.TypeError(engine.ValidTypeCompound, opt, env)
+		}
+	}
+	return iter.Err()
+}
+
+func atomArg(t engine.Term, env *engine.Env) (string, error) {
+	switch t := env.Resolve(t).(type) {
+	case engine.Variable:
+		return "", engine.InstantiationError(env)
+	case engine.Atom:
+		return string(t), nil
+	default:
+		return "", engine.TypeError(engine.ValidTypeAtom, t, env)
+	}
+}
+
+func intArg(t engine.Term, env *engine.Env) (int64, error) {
+	switch t := env.Resolve(t).(type) {
+	case engine.Variable:
+		return 0, engine.InstantiationError(env)
+	case engine.Integer:
+		if t < 0 {
+			return 0, engine.DomainError(engine.ValidDomainNotLessThanZero, t, env)
+		}
+		return int64(t), nil
+	default:
+		return 0, engine.TypeError(engine.ValidTypeInteger, t, env)
+	}
+}
+
+func boolArg(t engine.Term, env *engine.Env) (bool, error) {
+	switch t := env.Resolve(t).(type) {
+	case engine.Variable:
+		return false, engine.InstantiationError(env)
+	case engine.Atom:
+		switch t {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return false, domainError("boolean", t, env)
+	default:
+		return false, engine.TypeError(engine.ValidTypeAtom, t, env)
+	}
+}
+
+// domainError is like engine.DomainError but takes an arbitrary domain.
+func domainError(domain engine.Atom, culprit engine.Term, env *engine.Env) engine.Exception {
+	return domainErrorTerm(domain, culprit, env)
+}
+
+// existenceError is like engine.ExistenceError but takes an arbitrary object type.
+func existenceError(objectType engine.Atom, culprit engine.Term, env *engine.Env) engine.Exception {
+	return engine.NewException(engine.Atom("error").Apply(
+		engine.Atom("existence_error").Apply(objectType, culprit),
+		engine.NewVariable(),
+	), env)
+}
+
+// typeError is like engine.TypeError but takes an arbitrary type.
+func typeError(typ engine.Atom, culprit engine.Term, env *engine.Env) engine.Exception {
+	return engine.NewException(engine.Atom("error").Apply(
+		engine.Atom("type_error").Apply(typ, culprit),
+		engine.NewVariable(),
+	), env)
+}
+
+// domainErrorTerm is like domainError but the domain can be any term.
+func domainErrorTerm(domain, culprit engine.Term, env *engine.Env) engine.Exception {
+	return engine.NewException(engine.Atom("error").Apply(
+		engine.Atom("domain_error").Apply(domain, culprit),
+		engine.NewVariable(),
+	), env)
+}
+
+// writeOptions are the options for conditional writes such as put_item/3.
+type writeOptions struct {
+	// every if(Cond) option joined with AND, nil if there are none
+	cond *dynamo.ExpressionLiteral
+	// throw an error instead of failing when a condition fails
+	throw bool
+	// ttl(Seconds) or expires_at(Timestamp) option, nil if not given
+	expiry engine.Term
+	// expiry time as a Unix timestamp, or seconds from now if relative
+	expires  int64
+	relative bool
+	timeout  time.Duration
+}
+
+// parseWriteOptions parses the list of options for a write:
+// if(Cond) to only write when Cond holds, if_failed(fail) or if_failed(error) to
+// control what happens when it doesn't, ttl(Seconds) or expires_at(Timestamp) to set the item's expiry,
+// and timeout(Ms) to give up after Ms milliseconds.
+func parseWriteOptions(opts engine.Term, env *engine.Env) (writeOptions, error) {
+	var wo writeOptions
+	// conditions share a compiler so their placeholders don't clash
+	var c compiler
+	var conds []string
+	err := eachOption(opts, env, func(opt engine.Compound) error {
+		switch {
+		case opt.Functor() == "if" && opt.Arity() == 1:
+			expr, err := c.condition(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			conds = append(conds, "("+expr+")")
+		case opt.Functor() == "if_failed" && opt.Arity() == 1:
+			action, err := atomArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			switch action {
+			case "fail":
+				wo.throw = false
+			case "error":
+				wo.throw = true
+			default:
+				return domainError("if_failed", opt.Arg(0), env)
+			}
+		case (opt.Functor() == "ttl" || opt.Functor() == "expires_at") && opt.Arity() == 1:
+			n, err := intArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			wo.expiry = opt
+			wo.expires = n
+			wo.relative = opt.Functor() == "ttl"
+		case opt.Functor() == "timeout" && opt.Arity() == 1:
+			timeout, err := timeoutArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			wo.timeout = timeout
+		default:
+			return domainError("write_option", opt, env)
+		}
+		return nil
+	})
+	if len(conds) > 0 {
+		cond := c.literal(strings.Join(conds, " AND "))
+		wo.cond = &cond
+	}
+	return wo, err
+}
+
+// expiresAt returns the expiry time as a Unix timestamp.
+func (wo writeOptions) expiresAt(now time.Time) int64 {
+	if wo.relative {
+		return now.Unix() + wo.expires
+	}
+	return wo.expires
+}
+
+// result handles the error from running a write to table.
+func (wo writeOptions) result(err error, table string, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	switch {
+	case err == nil:
+		return k(env)
+	case isConditionFailed(err) && !wo.throw:
+		return engine.Bool(false)
+	}
+	return throw(err, table, env)
+}
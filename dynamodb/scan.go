@@ -0,0 +1,222 @@
+package dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/guregu/dynamo"
+	"github.com/ichiban/prolog/engine"
+)
+
+// scanRequest is a Scan request built from scan/3 options.
+type scanRequest struct {
+	input *dynamodb.ScanInput
+	// maximum number of items to return, or 0 for no limit
+	limit int64
+	// start(end) was given, so there is nothing left to scan
+	done bool
+	// skip items whose TTL has expired
+	skipExpired bool
+	timeout     time.Duration
+}
+
+// scanInput builds a Scan request for table from the list of scan/3 options.
+func scanInput(table string, options engine.Term, env *engine.Env) (scanRequest, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(table),
+	}
+	var c compiler
+	var filters []string
+	var limit int64
+	var done, skipExpired bool
+	var timeout time.Duration
+	err := eachOption(options, env, func(opt engine.Compound) error {
+		switch {
+		case opt.Functor() == "filter" && opt.Arity() == 1:
+			expr, err := c.condition(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			filters = append(filters, "("+expr+")")
+		case opt.Functor() == "project" && opt.Arity() == 1:
+			expr, err := c.projection(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			input.ProjectionExpression = aws.String(expr)
+		case opt.Functor() == "limit" && opt.Arity() == 1:
+			n, err := intArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			limit = n
+		case opt.Functor() == "page_limit" && opt.Arity() == 1:
+			n, err := intArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			input.Limit = aws.Int64(n)
+		case opt.Functor() == "consistent" && opt.Arity() == 1:
+			on, err := boolArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			input.ConsistentRead = aws.Bool(on)
+		case opt.Functor() == "index" && opt.Arity() == 1:
+			index, err := atomArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			input.IndexName = aws.String(index)
+		case opt.Functor() == "segment" && opt.Arity() == 2:
+			segment, err := intArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			total, err := intArg(opt.Arg(1), env)
+			if err != nil {
+				return err
+			}
+			if segment >= total {
+				return domainError("segment", opt, env)
+			}
+			input.Segment = aws.Int64(segment)
+			input.TotalSegments = aws.Int64(total)
+		case opt.Functor() == "start" && opt.Arity() == 1:
+			key, err := decodeCursor(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			input.ExclusiveStartKey = key
+			done = key == nil
+		case opt.Functor() == "skip_expired" && opt.Arity() == 1:
+			on, err := boolArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			skipExpired = on
+		case opt.Functor() == "timeout" && opt.Arity() == 1:
+			t, err := timeoutArg(opt.Arg(0), env)
+			if err != nil {
+				return err
+			}
+			timeout = t
+		default:
+			return domainError("scan_option", opt, env)
+		}
+		return nil
+	})
+	if err != nil {
+		return scanRequest{}, err
+	}
+
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+	}
+	input.ExpressionAttributeNames = c.names
+	input.ExpressionAttributeValues = c.values
+	return scanRequest{input: input, limit: limit, done: done, skipExpired: skipExpired, timeout: timeout}, nil
+}
+
+// endCursor is the cursor after the last page.
+const endCursor = engine.Atom("end")
+
+// encodeCursor encodes the LastEvaluatedKey of a page as an opaque atom that is safe to use in URLs.
+func encodeCursor(key map[string]*dynamodb.AttributeValue) (engine.Atom, error) {
+	if key == nil {
+		return endCursor, nil
+	}
+	data, err := marshalItem(key)
+	if err != nil {
+		return "", err
+	}
+	return engine.Atom(base64.RawURLEncoding.EncodeToString(data)), nil
+}
+
+// decodeCursor decodes a cursor from encodeCursor, returning nil for the end cursor.
+func decodeCursor(t engine.Term, env *engine.Env) (map[string]*dynamodb.AttributeValue, error) {
+	cursor, err := atomArg(t, env)
+	if err != nil {
+		return nil, err
+	}
+	if engine.Atom(cursor) == endCursor {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, domainError("cursor", t, env)
+	}
+	key, err := unmarshalItem(data)
+	if err != nil || len(key) == 0 {
+		return nil, domainError("cursor", t, env)
+	}
+	return key, nil
+}
+
+// scanIter iterates over the results of a Scan request, fetching more pages as needed.
+type scanIter struct {
+	client dynamodbiface.DynamoDBAPI
+	input  *dynamodb.ScanInput
+	limit  int64
+
+	output *dynamodb.ScanOutput
+	idx    int
+	n      int64
+	err    error
+}
+
+var _ dynamo.Iter = (*scanIter)(nil)
+
+func newScanIter(client dynamodbiface.DynamoDBAPI, req scanRequest) *scanIter {
+	itr := &scanIter{
+		client: client,
+		input:  req.input,
+		limit:  req.limit,
+	}
+	if req.done {
+		itr.output = &dynamodb.ScanOutput{}
+	}
+	return itr
+}
+
+func (itr *scanIter) Next(out interface{}) bool {
+	return itr.NextWithContext(context.Background(), out)
+}
+
+func (itr *scanIter) NextWithContext(ctx aws.Context, out interface{}) bool {
+	if itr.err != nil {
+		return false
+	}
+	if itr.limit > 0 && itr.n >= itr.limit {
+		return false
+	}
+
+	for itr.output == nil || itr.idx >= len(itr.output.Items) {
+		if itr.output != nil {
+			if itr.output.LastEvaluatedKey == nil {
+				return false
+			}
+			itr.input.ExclusiveStartKey = itr.output.LastEvaluatedKey
+		}
+		itr.output, itr.err = itr.client.ScanWithContext(ctx, itr.input)
+		if itr.err != nil {
+			return false
+		}
+		itr.idx = 0
+	}
+
+	item := itr.output.Items[itr.idx]
+	itr.idx++
+	itr.n++
+	itr.err = dynamo.UnmarshalItem(item, out)
+	return itr.err == nil
+}
+
+func (itr *scanIter) Err() error {
+	return itr.err
+}
@@ -0,0 +1,408 @@
+package dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ichiban/prolog/engine"
+)
+
+// tableSchema is the key schema of a table, as reported by DescribeTable.
+// It is used to convert plain Prolog values into key attribute values.
+type tableSchema struct {
+	keySchema
+	// types of every key attribute (including indexes) by name: S, N, or B
+	types   map[string]string
+	indexes map[string]indexSchema
+}
+
+// keySchema is the partition key and sort key of a table or index.
+// sk is empty if there is no sort key.
+type keySchema struct {
+	pk, sk string
+}
+
+// indexSchema describes a secondary index.
+type indexSchema struct {
+	keySchema
+	// ALL, KEYS_ONLY, or INCLUDE
+	projection string
+	// non-key attributes for INCLUDE
+	attrs []string
+}
+
+func newTableSchema(desc *dynamodb.TableDescription) *tableSchema {
+	s := &tableSchema{
+		keySchema: newKeySchema(desc.KeySchema),
+		types:     make(map[string]string, len(desc.AttributeDefinitions)),
+		indexes:   make(map[string]indexSchema, len(desc.GlobalSecondaryIndexes)+len(desc.LocalSecondaryIndexes)),
+	}
+	for _, ad := range desc.AttributeDefinitions {
+		s.types[aws.StringValue(ad.AttributeName)] = aws.StringValue(ad.AttributeType)
+	}
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		s.indexes[aws.StringValue(gsi.IndexName)] = newIndexSchema(gsi.KeySchema, gsi.Projection)
+	}
+	for _, lsi := range desc.LocalSecondaryIndexes {
+		s.indexes[aws.StringValue(lsi.IndexName)] = newIndexSchema(lsi.KeySchema, lsi.Projection)
+	}
+	return s
+}
+
+func newKeySchema(schema []*dynamodb.KeySchemaElement) keySchema {
+	var ks keySchema
+	for _, elem := range schema {
+		switch aws.StringValue(elem.KeyType) {
+		case dynamodb.KeyTypeHash:
+			ks.pk = aws.StringValue(elem.AttributeName)
+		case dynamodb.KeyTypeRange:
+			ks.sk = aws.StringValue(elem.AttributeName)
+		}
+	}
+	return ks
+}
+
+func newIndexSchema(schema []*dynamodb.KeySchemaElement, proj *dynamodb.Projection) indexSchema {
+	idx := indexSchema{
+		keySchema:  newKeySchema(schema),
+		projection: dynamodb.ProjectionTypeAll,
+	}
+	if proj != nil {
+		idx.projection = aws.StringValue(proj.ProjectionType)
+		idx.attrs = aws.StringValueSlice(proj.NonKeyAttributes)
+	}
+	return idx
+}
+
+// schemaCache holds the key schemas and TTL attributes of tables, so each table is only described once.
+type schemaCache struct {
+	mu      sync.Mutex
+	schemas map[string]*tableSchema
+	// TTL attribute names, "" if TTL is disabled
+	ttls map[string]string
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{
+		schemas: make(map[string]*tableSchema),
+		ttls:    make(map[string]string),
+	}
+}
+
+// schema returns the key schema of table, describing it if necessary.
+func (d Dynamo) schema(ctx context.Context, table string) (*tableSchema, error) {
+	d.schemas.mu.Lock()
+	s, ok := d.schemas.schemas[table]
+	d.schemas.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	out, err := d.db.Client().DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s = newTableSchema(out.Table)
+
+	d.schemas.mu.Lock()
+	d.schemas.schemas[table] = s
+	d.schemas.mu.Unlock()
+	return s, nil
+}
+
+// forget removes table from the schema cache and the item cache.
+func (d Dynamo) forget(table string) {
+	d.schemas.mu.Lock()
+	delete(d.schemas.schemas, table)
+	delete(d.schemas.ttls, table)
+	d.schemas.mu.Unlock()
+	d.cache.purge(table)
+}
+
+// itemKey parses the key t for table, checking it against the table's key schema.
+// Plain values are converted to the key attributes' types, and explicitly typed values such as 'ID'-s(x) must match them.
+func (d Dynamo) itemKey(ctx context.Context, table string, t engine.Term, env *engine.Env) (itemKey, error) {
+	s, err := d.schema(ctx, table)
+	if err != nil {
+		return itemKey{}, err
+	}
+	return s.itemKey(t, env)
+}
+
+func isPair(t engine.Term, env *engine.Env) bool {
+	cmp, ok := env.Resolve(t).(engine.Compound)
+	return ok && cmp.Functor() == "-" && cmp.Arity() == 2
+}
+
+// itemKey parses a key in any of these forms:
+//
+//	pk-V
+//	pk-V-&-sk-V
+//	key(pk-V, sk-V)
+//	[pk-V, sk-V]
+//	key(PKValue)
+//	key(PKValue, SKValue)
+//
+// Values may be plain atoms or numbers, which are converted to the key attribute's type.
+func (s *tableSchema) itemKey(t engine.Term, env *engine.Env) (itemKey, error) {
+	var key itemKey
+	values := make(map[string]engine.Term, 2)
+	set := func(name string, v engine.Term) error {
+		if _, dupe := values[name]; dupe {
+			return s.keyError(t, env)
+		}
+		values[name] = v
+		return nil
+	}
+
+	switch cmp := env.Resolve(t).(type) {
+	case engine.Variable:
+		return key, engine.InstantiationError(env)
+	case engine.Compound:
+		switch {
+		case cmp.Functor() == "." && cmp.Arity() == 2:
+			if err := eachPair(cmp, env, set); err != nil {
+				return key, err
+			}
+		case cmp.Functor() == "key" && !isPair(cmp.Arg(0), env):
+			if cmp.Arity() != s.arity() {
+				return key, s.keyError(t, env)
+			}
+			values[s.pk] = cmp.Arg(0)
+			if s.sk != "" {
+				values[s.sk] = cmp.Arg(1)
+			}
+		default:
+			pk, rk, err := splitkeys(cmp, env)
+			if err != nil {
+				return key, err
+			}
+			for _, kv := range []engine.Term{pk, rk} {
+				if kv == nil {
+					continue
+				}
+				name, v, err := splitkey(env.Resolve(kv), env)
+				if err != nil {
+					return key, err
+				}
+				if err := set(name, v); err != nil {
+					return key, err
+				}
+			}
+		}
+	default:
+		return key, s.keyError(t, env)
+	}
+
+	if len(values) != s.arity() {
+		return key, s.keyError(t, env)
+	}
+	pv, ok := values[s.pk]
+	if !ok {
+		return key, s.keyError(t, env)
+	}
+	var err error
+	key.pk = s.pk
+	if key.pv, err = s.value(s.pk, pv, env); err != nil {
+		return key, err
+	}
+	if s.sk != "" {
+		sv, ok := values[s.sk]
+		if !ok {
+			return key, s.keyError(t, env)
+		}
+		key.sk = s.sk
+		if key.sv, err = s.value(s.sk, sv, env); err != nil {
+			return key, err
+		}
+	}
+	return key, nil
+}
+
+// value converts v into a value for the key attribute name.
+// Plain atoms and numbers are converted to the attribute's type, typed values must match it.
+// A nil schema converts values with prolog2av.
+func (s *tableSchema) value(name string, v engine.Term, env *engine.Env) (*dynamodb.AttributeValue, error) {
+	if s == nil {
+		return prolog2av(v, env)
+	}
+	typ, ok := s.types[name]
+	if !ok {
+		return nil, s.keyError(engine.Atom(name), env)
+	}
+
+	switch v := env.Resolve(v).(type) {
+	case engine.Variable:
+		return nil, engine.InstantiationError(env)
+	case engine.Atom:
+		switch typ {
+		case dynamodb.ScalarAttributeTypeS:
+			return &dynamodb.AttributeValue{S: aws.String(string(v))}, nil
+		case dynamodb.ScalarAttributeTypeN:
+			if isNumber(string(v)) {
+				return &dynamodb.AttributeValue{N: aws.String(string(v))}, nil
+			}
+		case dynamodb.ScalarAttributeTypeB:
+			if b, err := base64.StdEncoding.DecodeString(string(v)); err == nil {
+				return &dynamodb.AttributeValue{B: b}, nil
+			}
+		}
+	case engine.Integer, engine.Float:
+		av, err := prolog2av(v, env)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case dynamodb.ScalarAttributeTypeN:
+			return av, nil
+		case dynamodb.ScalarAttributeTypeS:
+			return &dynamodb.AttributeValue{S: av.N}, nil
+		}
+	case engine.Compound:
+		av, err := prolog2av(v, env)
+		if err != nil {
+			return nil, err
+		}
+		if (typ == dynamodb.ScalarAttributeTypeS && av.S != nil) ||
+			(typ == dynamodb.ScalarAttributeTypeN && av.N != nil) ||
+			(typ == dynamodb.ScalarAttributeTypeB && av.B != nil) {
+			return av, nil
+		}
+	}
+	return nil, s.keyError(v, env)
+}
+
+// checkKeyCond checks that the key condition t uses the attributes of the key schema ks.
+func (s *tableSchema) checkKeyCond(ks keySchema, t engine.Term, env *engine.Env) error {
+	pk, rk, err := splitkeys(env.Resolve(t), env)
+	if err != nil {
+		return err
+	}
+	name, _, err := splitkey(env.Resolve(pk), env)
+	if err != nil {
+		return err
+	}
+	if name != ks.pk {
+		return s.schemaError(ks, t, env)
+	}
+	if rk == nil {
+		return nil
+	}
+	cond, ok := env.Resolve(rk).(engine.Compound)
+	if !ok || cond.Arity() != 2 {
+		return engine.TypeError(engine.ValidTypePair, rk, env)
+	}
+	if sk, ok := env.Resolve(cond.Arg(0)).(engine.Atom); !ok || ks.sk == "" || string(sk) != ks.sk {
+		return s.schemaError(ks, t, env)
+	}
+	return nil
+}
+
+// checkProjection checks that every attribute in the item pattern t is projected into index.
+// t can be a partial list of Attr-Value pairs; anything else is not checked.
+func (s *tableSchema) checkProjection(index string, t engine.Term, env *engine.Env) error {
+	idx := s.indexes[index]
+	for {
+		cell, ok := env.Resolve(t).(engine.Compound)
+		if !ok || cell.Functor() != "." || cell.Arity() != 2 {
+			return nil
+		}
+		if elem, ok := env.Resolve(cell.Arg(0)).(engine.Compound); ok && elem.Functor() == "-" && elem.Arity() == 2 {
+			if attr, ok := env.Resolve(elem.Arg(0)).(engine.Atom); ok && !s.projected(idx, string(attr)) {
+				return s.projectionError(index, attr, env)
+			}
+		}
+		t = cell.Arg(1)
+	}
+}
+
+func (ks keySchema) arity() int {
+	if ks.sk == "" {
+		return 1
+	}
+	return 2
+}
+
+// keyError returns error(domain_error(key_schema(['UserID'-n, 'Time'-s]), Culprit), _) for the table's key schema.
+func (s *tableSchema) keyError(culprit engine.Term, env *engine.Env) engine.Exception {
+	return s.schemaError(s.keySchema, culprit, env)
+}
+
+// schemaError is like keyError, but for the key schema ks.
+func (s *tableSchema) schemaError(ks keySchema, culprit engine.Term, env *engine.Env) engine.Exception {
+	attrs := []engine.Term{pair(ks.pk, engine.Atom(strings.ToLower(s.types[ks.pk])))}
+	if ks.sk != "" {
+		attrs = append(attrs, pair(ks.sk, engine.Atom(strings.ToLower(s.types[ks.sk]))))
+	}
+	return domainErrorTerm(engine.Atom("key_schema").Apply(engine.List(attrs...)), culprit, env)
+}
+
+// projected reports whether the index carries the attribute attr.
+func (s *tableSchema) projected(idx indexSchema, attr string) bool {
+	switch attr {
+	case s.pk, s.sk, idx.pk, idx.sk:
+		return attr != ""
+	}
+	switch idx.projection {
+	case dynamodb.ProjectionTypeAll:
+		return true
+	case dynamodb.ProjectionTypeInclude:
+		for _, a := range idx.attrs {
+			if a == attr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// projectionError returns error(domain_error(index_projection(Index, Attrs), Culprit), _)
+// where Attrs is the list of attributes the index carries, or all if it carries every attribute.
+func (s *tableSchema) projectionError(index string, culprit engine.Term, env *engine.Env) engine.Exception {
+	idx := s.indexes[index]
+	var attrs engine.Term = engine.Atom("all")
+	if idx.projection != dynamodb.ProjectionTypeAll {
+		var list []engine.Term
+		for _, attr := range []string{s.pk, s.sk, idx.pk, idx.sk} {
+			if attr != "" && !containsTerm(list, engine.Atom(attr)) {
+				list = append(list, engine.Atom(attr))
+			}
+		}
+		for _, attr := range idx.attrs {
+			list = append(list, engine.Atom(attr))
+		}
+		attrs = engine.List(list...)
+	}
+	return domainErrorTerm(engine.Atom("index_projection").Apply(engine.Atom(index), attrs), culprit, env)
+}
+
+func containsTerm(list []engine.Term, t engine.Term) bool {
+	for _, elem := range list {
+		if elem == t {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumber reports whether s is a valid DynamoDB number.
+func isNumber(s string) bool {
+	if strings.ContainsAny(s, "xX") {
+		// no hexadecimal
+		return false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return errors.Is(err, strconv.ErrRange)
+	}
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
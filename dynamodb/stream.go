@@ -0,0 +1,151 @@
+package dynamodb
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/ichiban/prolog/engine"
+)
+
+// streamReader reads every record of a stream, one shard at a time, parents before children.
+// It starts from the oldest record of each shard (TRIM_HORIZON) and stops after the last record of closed shards
+// or at the first empty batch of open shards, so reading a stream always ends.
+type streamReader struct {
+	client dynamodbstreamsiface.DynamoDBStreamsAPI
+	arn    string
+
+	shards  []*dynamodbstreams.Shard
+	iter    *string // current shard iterator, nil between shards
+	open    bool    // whether the current shard is still being written to
+	records []*dynamodbstreams.Record
+}
+
+func newStreamReader(ctx context.Context, client dynamodbstreamsiface.DynamoDBStreamsAPI, arn string) (*streamReader, error) {
+	var shards []*dynamodbstreams.Shard
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(arn)}
+	for {
+		out, err := client.DescribeStreamWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, out.StreamDescription.Shards...)
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			break
+		}
+		input.ExclusiveStartShardId = out.StreamDescription.LastEvaluatedShardId
+	}
+	return &streamReader{
+		client: client,
+		arn:    arn,
+		shards: sortShards(shards),
+	}, nil
+}
+
+// next returns the next record, or nil when there are no more records.
+func (r *streamReader) next(ctx context.Context) (*dynamodbstreams.Record, error) {
+	for len(r.records) == 0 {
+		if r.iter == nil {
+			if len(r.shards) == 0 {
+				return nil, nil
+			}
+			shard := r.shards[0]
+			r.shards = r.shards[1:]
+			out, err := r.client.GetShardIteratorWithContext(ctx, &dynamodbstreams.GetShardIteratorInput{
+				StreamArn:         aws.String(r.arn),
+				ShardId:           shard.ShardId,
+				ShardIteratorType: aws.String(dynamodbstreams.ShardIteratorTypeTrimHorizon),
+			})
+			if err != nil {
+				return nil, err
+			}
+			r.iter = out.ShardIterator
+			r.open = shard.SequenceNumberRange == nil || shard.SequenceNumberRange.EndingSequenceNumber == nil
+			continue
+		}
+
+		out, err := r.client.GetRecordsWithContext(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: r.iter,
+		})
+		if err != nil {
+			return nil, err
+		}
+		r.records = out.Records
+		r.iter = out.NextShardIterator
+		if len(out.Records) == 0 && r.open {
+			// caught up with an open shard
+			r.iter = nil
+		}
+	}
+	rec := r.records[0]
+	r.records = r.records[1:]
+	return rec, nil
+}
+
+// sortShards orders shards so that parents come before their children.
+func sortShards(shards []*dynamodbstreams.Shard) []*dynamodbstreams.Shard {
+	pending := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		pending[aws.StringValue(shard.ShardId)] = true
+	}
+	sorted := make([]*dynamodbstreams.Shard, 0, len(shards))
+	for progress := true; progress; {
+		progress = false
+		for _, shard := range shards {
+			id := aws.StringValue(shard.ShardId)
+			if !pending[id] {
+				continue
+			}
+			if parent := aws.StringValue(shard.ParentShardId); parent != "" && parent != id && pending[parent] {
+				continue
+			}
+			pending[id] = false
+			sorted = append(sorted, shard)
+			progress = true
+		}
+	}
+	return sorted
+}
+
+// event converts a stream record into insert(NewItem), modify(OldItem, NewItem), or remove(OldKeys).
+// Missing images, depending on the stream's view type, are replaced with the item's keys.
+func (d Dynamo) event(rec *dynamodbstreams.Record) (engine.Term, error) {
+	change := rec.Dynamodb
+	if change == nil {
+		change = new(dynamodbstreams.StreamRecord)
+	}
+	image := func(img map[string]*dynamodb.AttributeValue) (engine.Term, error) {
+		if img == nil {
+			img = change.Keys
+		}
+		return d.item2prolog(img)
+	}
+
+	switch aws.StringValue(rec.EventName) {
+	case dynamodbstreams.OperationTypeInsert:
+		item, err := image(change.NewImage)
+		if err != nil {
+			return nil, err
+		}
+		return engine.Atom("insert").Apply(item), nil
+	case dynamodbstreams.OperationTypeModify:
+		old, err := image(change.OldImage)
+		if err != nil {
+			return nil, err
+		}
+		item, err := image(change.NewImage)
+		if err != nil {
+			return nil, err
+		}
+		return engine.Atom("modify").Apply(old, item), nil
+	case dynamodbstreams.OperationTypeRemove:
+		keys, err := d.item2prolog(change.Keys)
+		if err != nil {
+			return nil, err
+		}
+		return engine.Atom("remove").Apply(keys), nil
+	}
+	return nil, domainError("stream_event", engine.Atom(aws.StringValue(rec.EventName)), nil)
+}
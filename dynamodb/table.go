@@ -0,0 +1,304 @@
+package dynamodb
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ichiban/prolog/engine"
+)
+
+// desc2prolog converts a table description into a key-value list.
+//
+//	[name-users, status-active, key_schema-['UserID'-hash, 'Time'-range], attributes-['UserID'-n, 'Time'-s],
+//		global_indexes-[Name-[key_schema-[...], projection-all, status-active]], local_indexes-[...],
+//		item_count-42, size-1024, billing_mode-provisioned, throughput-[read-5, write-1], stream-new_and_old_images]
+//
+// throughput is only present for provisioned tables and stream is only present for tables with a stream enabled.
+func desc2prolog(desc *dynamodb.TableDescription) engine.Term {
+	info := []engine.Term{
+		pair("name", engine.Atom(aws.StringValue(desc.TableName))),
+		pair("status", lower(desc.TableStatus)),
+		pair("key_schema", keySchema2prolog(desc.KeySchema)),
+	}
+
+	attrs := make([]engine.Term, 0, len(desc.AttributeDefinitions))
+	for _, ad := range desc.AttributeDefinitions {
+		attrs = append(attrs, pair(aws.StringValue(ad.AttributeName), lower(ad.AttributeType)))
+	}
+	info = append(info, pair("attributes", engine.List(attrs...)))
+
+	gsis := make([]engine.Term, 0, len(desc.GlobalSecondaryIndexes))
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		gsis = append(gsis, pair(aws.StringValue(gsi.IndexName), engine.List(
+			pair("key_schema", keySchema2prolog(gsi.KeySchema)),
+			pair("projection", projection2prolog(gsi.Projection)),
+			pair("status", lower(gsi.IndexStatus)),
+		)))
+	}
+	info = append(info, pair("global_indexes", engine.List(gsis...)))
+
+	lsis := make([]engine.Term, 0, len(desc.LocalSecondaryIndexes))
+	for _, lsi := range desc.LocalSecondaryIndexes {
+		lsis = append(lsis, pair(aws.StringValue(lsi.IndexName), engine.List(
+			pair("key_schema", keySchema2prolog(lsi.KeySchema)),
+			pair("projection", projection2prolog(lsi.Projection)),
+		)))
+	}
+	info = append(info, pair("local_indexes", engine.List(lsis...)))
+
+	info = append(info,
+		pair("item_count", engine.Integer(aws.Int64Value(desc.ItemCount))),
+		pair("size", engine.Integer(aws.Int64Value(desc.TableSizeBytes))),
+	)
+
+	billing := engine.Atom("provisioned")
+	if desc.BillingModeSummary != nil && aws.StringValue(desc.BillingModeSummary.BillingMode) == dynamodb.BillingModePayPerRequest {
+		billing = "pay_per_request"
+	}
+	info = append(info, pair("billing_mode", billing))
+	// DynamoDB reports zero throughput for on-demand tables, which can't be used to create one
+	if tp := desc.ProvisionedThroughput; tp != nil && billing == "provisioned" {
+		info = append(info, pair("throughput", engine.List(
+			pair("read", engine.Integer(aws.Int64Value(tp.ReadCapacityUnits))),
+			pair("write", engine.Integer(aws.Int64Value(tp.WriteCapacityUnits))),
+		)))
+	}
+	if spec := desc.StreamSpecification; spec != nil && aws.BoolValue(spec.StreamEnabled) {
+		info = append(info, pair("stream", lower(spec.StreamViewType)))
+	}
+
+	return engine.List(info...)
+}
+
+func keySchema2prolog(schema []*dynamodb.KeySchemaElement) engine.Term {
+	keys := make([]engine.Term, 0, len(schema))
+	for _, ks := range schema {
+		keys = append(keys, pair(aws.StringValue(ks.AttributeName), lower(ks.KeyType)))
+	}
+	return engine.List(keys...)
+}
+
+func projection2prolog(proj *dynamodb.Projection) engine.Term {
+	if proj == nil {
+		return engine.Atom("all")
+	}
+	if aws.StringValue(proj.ProjectionType) == dynamodb.ProjectionTypeInclude {
+		attrs := make([]engine.Term, 0, len(proj.NonKeyAttributes))
+		for _, attr := range proj.NonKeyAttributes {
+			attrs = append(attrs, engine.Atom(aws.StringValue(attr)))
+		}
+		return engine.Atom("include").Apply(engine.List(attrs...))
+	}
+	return lower(proj.ProjectionType)
+}
+
+// prolog2create converts a key-value list in the same format as describe_table/2 into a CreateTable request.
+// Only key_schema, attributes, global_indexes, local_indexes, billing_mode, throughput, and stream are used.
+// Tables without billing_mode use on-demand billing unless they have throughput.
+// The throughput of on-demand tables is ignored.
+func prolog2create(name string, spec engine.Term, env *engine.Env) (*dynamodb.CreateTableInput, error) {
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(name),
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+	}
+	var billing string
+	iter := engine.ListIterator{List: env.Resolve(spec), Env: env}
+	for iter.Next() {
+		key, value, err := splitkey(iter.Current(), env)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "key_schema":
+			input.KeySchema, err = prolog2keySchema(value, env)
+		case "attributes":
+			err = eachPair(value, env, func(name string, typ engine.Term) error {
+				t, err := atomArg(typ, env)
+				if err != nil {
+					return err
+				}
+				input.AttributeDefinitions = append(input.AttributeDefinitions, &dynamodb.AttributeDefinition{
+					AttributeName: aws.String(name),
+					AttributeType: aws.String(strings.ToUpper(t)),
+				})
+				return nil
+			})
+		case "global_indexes":
+			err = eachPair(value, env, func(name string, spec engine.Term) error {
+				schema, proj, err := prolog2index(spec, env)
+				if err != nil {
+					return err
+				}
+				input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndex{
+					IndexName:  aws.String(name),
+					KeySchema:  schema,
+					Projection: proj,
+				})
+				return nil
+			})
+		case "local_indexes":
+			err = eachPair(value, env, func(name string, spec engine.Term) error {
+				schema, proj, err := prolog2index(spec, env)
+				if err != nil {
+					return err
+				}
+				input.LocalSecondaryIndexes = append(input.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndex{
+					IndexName:  aws.String(name),
+					KeySchema:  schema,
+					Projection: proj,
+				})
+				return nil
+			})
+		case "throughput":
+			tp := &dynamodb.ProvisionedThroughput{}
+			err = eachPair(value, env, func(name string, units engine.Term) error {
+				n, err := intArg(units, env)
+				if err != nil {
+					return err
+				}
+				switch name {
+				case "read":
+					tp.ReadCapacityUnits = aws.Int64(n)
+				case "write":
+					tp.WriteCapacityUnits = aws.Int64(n)
+				default:
+					return domainError("throughput", engine.Atom(name), env)
+				}
+				return nil
+			})
+			input.ProvisionedThroughput = tp
+		case "billing_mode":
+			billing, err = atomArg(value, env)
+			switch billing {
+			case "provisioned", "pay_per_request":
+			default:
+				if err == nil {
+					err = domainError("billing_mode", value, env)
+				}
+			}
+		case "stream":
+			var view string
+			view, err = atomArg(value, env)
+			switch view {
+			case "keys_only", "new_image", "old_image", "new_and_old_images":
+				input.StreamSpecification = &dynamodb.StreamSpecification{
+					StreamEnabled:  aws.Bool(true),
+					StreamViewType: aws.String(strings.ToUpper(view)),
+				}
+			default:
+				if err == nil {
+					err = domainError("stream_view_type", value, env)
+				}
+			}
+		case "name", "status", "item_count", "size":
+			// ignore read-only information so describe_table/2 output can be used as-is
+		default:
+			err = domainError("table_spec", iter.Current(), env)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case billing == "pay_per_request":
+		input.ProvisionedThroughput = nil
+	case billing == "provisioned", input.ProvisionedThroughput != nil:
+		input.BillingMode = aws.String(dynamodb.BillingModeProvisioned)
+	}
+	// provisioned global indexes need their own throughput
+	if input.ProvisionedThroughput != nil {
+		for _, gsi := range input.GlobalSecondaryIndexes {
+			gsi.ProvisionedThroughput = input.ProvisionedThroughput
+		}
+	}
+	return input, nil
+}
+
+func prolog2keySchema(t engine.Term, env *engine.Env) ([]*dynamodb.KeySchemaElement, error) {
+	var schema []*dynamodb.KeySchemaElement
+	err := eachPair(t, env, func(name string, typ engine.Term) error {
+		kt, err := atomArg(typ, env)
+		if err != nil {
+			return err
+		}
+		switch kt {
+		case "hash", "range":
+		default:
+			return domainError("key_type", typ, env)
+		}
+		schema = append(schema, &dynamodb.KeySchemaElement{
+			AttributeName: aws.String(name),
+			KeyType:       aws.String(strings.ToUpper(kt)),
+		})
+		return nil
+	})
+	return schema, err
+}
+
+func prolog2index(t engine.Term, env *engine.Env) ([]*dynamodb.KeySchemaElement, *dynamodb.Projection, error) {
+	var schema []*dynamodb.KeySchemaElement
+	proj := &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)}
+	err := eachPair(t, env, func(name string, value engine.Term) error {
+		switch name {
+		case "key_schema":
+			var err error
+			schema, err = prolog2keySchema(value, env)
+			return err
+		case "projection":
+			switch value := env.Resolve(value).(type) {
+			case engine.Atom:
+				switch value {
+				case "all", "keys_only":
+					proj.ProjectionType = aws.String(strings.ToUpper(string(value)))
+					return nil
+				}
+			case engine.Compound:
+				if value.Functor() == "include" && value.Arity() == 1 {
+					proj.ProjectionType = aws.String(dynamodb.ProjectionTypeInclude)
+					iter := engine.ListIterator{List: value.Arg(0), Env: env}
+					for iter.Next() {
+						attr, err := atomArg(iter.Current(), env)
+						if err != nil {
+							return err
+						}
+						proj.NonKeyAttributes = append(proj.NonKeyAttributes, aws.String(attr))
+					}
+					return iter.Err()
+				}
+			}
+			return domainError("projection", value, env)
+		case "status":
+			return nil
+		}
+		return domainError("index_spec", engine.Atom(name), env)
+	})
+	return schema, proj, err
+}
+
+// eachPair calls fn for every Key-Value pair in the list t.
+func eachPair(t engine.Term, env *engine.Env, fn func(key string, value engine.Term) error) error {
+	iter := engine.ListIterator{List: env.Resolve(t), Env: env}
+	for iter.Next() {
+		key, value, err := splitkey(iter.Current(), env)
+		if err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func pair(key string, value engine.Term) engine.Term {
+	return engine.Atom("-").Apply(engine.Atom(key), value)
+}
+
+func lower(s *string) engine.Atom {
+	return engine.Atom(strings.ToLower(aws.StringValue(s)))
+}
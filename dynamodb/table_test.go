@@ -0,0 +1,119 @@
+package dynamodb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ichiban/prolog/engine"
+
+	"github.com/guregu/predicates/internal"
+)
+
+func TestTableSpec(t *testing.T) {
+	p := internal.NewTestProlog()
+	spec, err := p.Parser(strings.NewReader(`[
+		key_schema-['UserID'-hash, 'Time'-range],
+		attributes-['UserID'-n, 'Time'-s, email-s],
+		global_indexes-['ByEmail'-[key_schema-[email-hash], projection-include([name])]],
+		throughput-[read-5, write-1]
+	].`), nil).Term()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := prolog2create("users", spec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := *input.BillingMode; got != dynamodb.BillingModeProvisioned {
+		t.Error("bad billing mode:", got)
+	}
+	if got := *input.GlobalSecondaryIndexes[0].ProvisionedThroughput.ReadCapacityUnits; got != 5 {
+		t.Error("bad index throughput:", got)
+	}
+
+	desc := &dynamodb.TableDescription{
+		TableName:            input.TableName,
+		TableStatus:          aws.String(dynamodb.TableStatusActive),
+		KeySchema:            input.KeySchema,
+		AttributeDefinitions: input.AttributeDefinitions,
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndexDescription{{
+			IndexName:   input.GlobalSecondaryIndexes[0].IndexName,
+			KeySchema:   input.GlobalSecondaryIndexes[0].KeySchema,
+			Projection:  input.GlobalSecondaryIndexes[0].Projection,
+			IndexStatus: aws.String(dynamodb.IndexStatusActive),
+		}},
+		ItemCount:      aws.Int64(42),
+		TableSizeBytes: aws.Int64(1024),
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+	}
+
+	want, err := p.Parser(strings.NewReader(`[
+		name-users, status-active, key_schema-['UserID'-hash, 'Time'-range], attributes-['UserID'-n, 'Time'-s, email-s],
+		global_indexes-['ByEmail'-[key_schema-[email-hash], projection-include([name]), status-active]], local_indexes-[],
+		item_count-42, size-1024, billing_mode-provisioned, throughput-[read-5, write-1]
+	].`), nil).Term()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := desc2prolog(desc); writeTerm(got) != writeTerm(want) {
+		t.Error("bad description.\nwant:", writeTerm(want), "\ngot: ", writeTerm(got))
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		again, err := prolog2create("users", desc2prolog(desc), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.String() != input.String() {
+			t.Error("mismatch.\nwant:", input, "\ngot: ", again)
+		}
+	})
+
+	t.Run("on-demand", func(t *testing.T) {
+		// DynamoDB reports zero throughput for on-demand tables
+		desc := *desc
+		desc.BillingModeSummary = &dynamodb.BillingModeSummary{BillingMode: aws.String(dynamodb.BillingModePayPerRequest)}
+		desc.ProvisionedThroughput = &dynamodb.ProvisionedThroughputDescription{ReadCapacityUnits: aws.Int64(0), WriteCapacityUnits: aws.Int64(0)}
+		info := desc2prolog(&desc)
+		if got := writeTerm(info); strings.Contains(got, "throughput") {
+			t.Error("unexpected throughput:", got)
+		}
+		again, err := prolog2create("users", info, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := *again.BillingMode; got != dynamodb.BillingModePayPerRequest {
+			t.Error("bad billing mode:", got)
+		}
+		if again.ProvisionedThroughput != nil || again.GlobalSecondaryIndexes[0].ProvisionedThroughput != nil {
+			t.Error("unexpected throughput:", again)
+		}
+	})
+
+	t.Run("billing_mode", func(t *testing.T) {
+		spec, err := p.Parser(strings.NewReader(`[key_schema-['ID'-hash], attributes-['ID'-s], billing_mode-pay_per_request, throughput-[read-0, write-0]].`), nil).Term()
+		if err != nil {
+			t.Fatal(err)
+		}
+		input, err := prolog2create("users", spec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := *input.BillingMode; got != dynamodb.BillingModePayPerRequest || input.ProvisionedThroughput != nil {
+			t.Error("bad billing:", input)
+		}
+	})
+}
+
+func writeTerm(t engine.Term) string {
+	var buf bytes.Buffer
+	_ = engine.WriteTerm(&buf, t, &engine.WriteOptions{Quoted: true}, nil)
+	return buf.String()
+}
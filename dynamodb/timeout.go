@@ -0,0 +1,91 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/guregu/dynamo"
+	"github.com/ichiban/prolog/engine"
+)
+
+// timeoutArg parses the Ms argument of a timeout(Ms) option.
+func timeoutArg(t engine.Term, env *engine.Env) (time.Duration, error) {
+	ms, err := intArg(t, env)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// timeoutOption parses a list of options that can only have timeout(Ms).
+// Other options throw error(domain_error(Domain, Option), _).
+func timeoutOption(options engine.Term, domain engine.Atom, env *engine.Env) (time.Duration, error) {
+	var timeout time.Duration
+	err := eachOption(options, env, func(opt engine.Compound) error {
+		if opt.Functor() != "timeout" || opt.Arity() != 1 {
+			return domainError(domain, opt, env)
+		}
+		var err error
+		timeout, err = timeoutArg(opt.Arg(0), env)
+		return err
+	})
+	return timeout, err
+}
+
+// deadlineAfter returns the time timeout from now, or the zero time (no deadline) if timeout is 0.
+func deadlineAfter(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// withDeadline returns a copy of ctx that is canceled at deadline, unless deadline is zero.
+func withDeadline(ctx context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// deadlineIter wraps an iterator so that it gives up at deadline, no matter how many pages it fetches.
+type deadlineIter struct {
+	dynamo.Iter
+	deadline time.Time
+}
+
+// iterUntil returns iter with the given deadline, unless deadline is zero.
+func iterUntil(iter dynamo.Iter, deadline time.Time) dynamo.Iter {
+	if deadline.IsZero() {
+		return iter
+	}
+	return &deadlineIter{Iter: iter, deadline: deadline}
+}
+
+func (itr *deadlineIter) Next(out interface{}) bool {
+	return itr.NextWithContext(context.Background(), out)
+}
+
+func (itr *deadlineIter) NextWithContext(ctx aws.Context, out interface{}) bool {
+	ctx, cancel := context.WithDeadline(ctx, itr.deadline)
+	defer cancel()
+	return itr.Iter.NextWithContext(ctx, out)
+}
+
+// isTimeout reports whether err is caused by a context deadline, such as from the timeout(Ms) option.
+func isTimeout(err error) bool {
+	for err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return true
+		}
+		var ae awserr.Error
+		if !errors.As(err, &ae) {
+			return false
+		}
+		err = ae.OrigErr()
+	}
+	return false
+}
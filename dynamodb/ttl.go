@@ -0,0 +1,96 @@
+package dynamodb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+// ttlAttr returns the name of table's TTL attribute, or "" if TTL is disabled, describing it if necessary.
+func (d Dynamo) ttlAttr(ctx context.Context, table string) (string, error) {
+	d.schemas.mu.Lock()
+	attr, ok := d.schemas.ttls[table]
+	d.schemas.mu.Unlock()
+	if ok {
+		return attr, nil
+	}
+
+	out, err := d.db.Client().DescribeTimeToLiveWithContext(ctx, &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return "", err
+	}
+	if desc := out.TimeToLiveDescription; desc != nil {
+		switch aws.StringValue(desc.TimeToLiveStatus) {
+		case dynamodb.TimeToLiveStatusEnabled, dynamodb.TimeToLiveStatusEnabling:
+			attr = aws.StringValue(desc.AttributeName)
+		}
+	}
+
+	d.schemas.mu.Lock()
+	d.schemas.ttls[table] = attr
+	d.schemas.mu.Unlock()
+	return attr, nil
+}
+
+// expired reports whether the TTL attribute attr of item is a time before now.
+// DynamoDB deletes expired items eventually, so they can still be read for a while.
+func expired(item map[string]*dynamodb.AttributeValue, attr string, now time.Time) bool {
+	if attr == "" {
+		return false
+	}
+	av := item[attr]
+	if av == nil || av.N == nil {
+		return false
+	}
+	exp, err := strconv.ParseFloat(*av.N, 64)
+	return err == nil && exp < float64(now.Unix())
+}
+
+// unexpiredIter wraps an iterator, skipping items whose TTL attribute has expired.
+// If limit is positive, it returns at most limit items.
+type unexpiredIter struct {
+	dynamo.Iter
+	attr  string
+	limit int64
+
+	n   int64
+	err error
+}
+
+func (itr *unexpiredIter) Next(out interface{}) bool {
+	return itr.NextWithContext(context.Background(), out)
+}
+
+func (itr *unexpiredIter) NextWithContext(ctx aws.Context, out interface{}) bool {
+	if itr.err != nil {
+		return false
+	}
+	if itr.limit > 0 && itr.n >= itr.limit {
+		return false
+	}
+	for {
+		var item map[string]*dynamodb.AttributeValue
+		if !itr.Iter.NextWithContext(ctx, &item) {
+			return false
+		}
+		if expired(item, itr.attr, time.Now()) {
+			continue
+		}
+		itr.n++
+		itr.err = dynamo.UnmarshalItem(item, out)
+		return itr.err == nil
+	}
+}
+
+func (itr *unexpiredIter) Err() error {
+	if itr.err != nil {
+		return itr.err
+	}
+	return itr.Iter.Err()
+}
@@ -0,0 +1,210 @@
+package dynamodb
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ichiban/prolog/engine"
+)
+
+// declaredSchema is the schema of a table declared with dynamo_schema/2.
+// Items are checked against it before they are written.
+type declaredSchema struct {
+	attrs []declaredAttr
+}
+
+// declaredAttr is an attribute of a declared schema.
+type declaredAttr struct {
+	name string
+	// type name as used by dynamo_schema/2, such as n or ss
+	typ      engine.Atom
+	required bool
+}
+
+// declarations holds the schemas declared with dynamo_schema/2, by table.
+type declarations struct {
+	mu      sync.Mutex
+	schemas map[string]*declaredSchema
+}
+
+func newDeclarations() *declarations {
+	return &declarations{schemas: make(map[string]*declaredSchema)}
+}
+
+// declare parses the dynamo_schema/2 spec t, a list of:
+//
+//	key(Name, Type)
+//	sort(Name, Type)
+//	attr(Name, Type)
+//	attr(Name, Type, required | optional)
+//
+// There can be at most one key and one sort, and keys are always required.
+// Type is one of s, n, b, bool, null, ss, ns, bs, l, or m.
+func declare(t engine.Term, env *engine.Env) (*declaredSchema, error) {
+	schema := new(declaredSchema)
+	seen := make(map[string]bool)
+	keys := make(map[engine.Atom]bool)
+	iter := engine.ListIterator{List: env.Resolve(t), Env: env}
+	for iter.Next() {
+		var decl engine.Compound
+		switch d := env.Resolve(iter.Current()).(type) {
+		case engine.Variable:
+			return nil, engine.InstantiationError(env)
+		case engine.Compound:
+			decl = d
+		default:
+			return nil, engine.TypeError(engine.ValidTypeCompound, d, env)
+		}
+
+		var attr declaredAttr
+		switch {
+		case (decl.Functor() == "key" || decl.Functor() == "sort") && decl.Arity() == 2:
+			if keys[decl.Functor()] {
+				return nil, domainError("dynamo_schema", decl, env)
+			}
+			keys[decl.Functor()] = true
+			attr.required = true
+		case decl.Functor() == "attr" && decl.Arity() == 2:
+		case decl.Functor() == "attr" && decl.Arity() == 3:
+			req, err := atomArg(decl.Arg(2), env)
+			if err != nil {
+				return nil, err
+			}
+			switch req {
+			case "required":
+				attr.required = true
+			case "optional":
+			default:
+				return nil, domainError("attribute_option", decl.Arg(2), env)
+			}
+		default:
+			return nil, domainError("dynamo_schema", decl, env)
+		}
+
+		name, err := atomArg(decl.Arg(0), env)
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, domainError("dynamo_schema", decl, env)
+		}
+		seen[name] = true
+		attr.name = name
+
+		typ, err := atomArg(decl.Arg(1), env)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "s", "n", "b", "bool", "null", "ss", "ns", "bs", "l", "m":
+		default:
+			return nil, domainError("attribute_type", decl.Arg(1), env)
+		}
+		if decl.Functor() != "attr" && typ != "s" && typ != "n" && typ != "b" {
+			return nil, domainError("key_type", decl.Arg(1), env)
+		}
+		attr.typ = engine.Atom(typ)
+		schema.attrs = append(schema.attrs, attr)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// validate checks item against the schema declared for table, if any.
+// A missing required attribute throws error(domain_error(required(Name), Item), _)
+// and an attribute of the wrong type throws error(type_error(Type, Name-Value), _).
+// Attributes that aren't declared are allowed.
+func (d Dynamo) validate(table string, item map[string]*dynamodb.AttributeValue, env *engine.Env) error {
+	d.decls.mu.Lock()
+	schema := d.decls.schemas[table]
+	d.decls.mu.Unlock()
+	if schema == nil {
+		return nil
+	}
+
+	for _, attr := range schema.attrs {
+		av, ok := item[attr.name]
+		if !ok {
+			if attr.required {
+				return domainErrorTerm(engine.Atom("required").Apply(engine.Atom(attr.name)), item2prolog(item), env)
+			}
+			continue
+		}
+		if avType(av) != attr.typ {
+			return typeError(attr.typ, pair(attr.name, av2prolog(av)), env)
+		}
+	}
+	return nil
+}
+
+// validateUpdate checks the update actions t, already compiled by compiler.update, against the schema declared for table, if any.
+// Setting, adding, or deleting a value of the wrong type throws error(type_error(Type, Name-Value), _)
+// and removing a required attribute throws error(domain_error(required(Name), remove(Name)), _).
+func (d Dynamo) validateUpdate(table string, t engine.Term, env *engine.Env) error {
+	d.decls.mu.Lock()
+	schema := d.decls.schemas[table]
+	d.decls.mu.Unlock()
+	if schema == nil {
+		return nil
+	}
+
+	attrs := make(map[string]declaredAttr, len(schema.attrs))
+	for _, attr := range schema.attrs {
+		attrs[attr.name] = attr
+	}
+	iter := engine.ListIterator{List: env.Resolve(t), Env: env}
+	for iter.Next() {
+		action := env.Resolve(iter.Current()).(engine.Compound)
+		name, _ := atomArg(action.Arg(0), env)
+		attr, ok := attrs[name]
+		if !ok {
+			continue
+		}
+		if action.Arity() == 1 {
+			if attr.required {
+				return domainErrorTerm(engine.Atom("required").Apply(engine.Atom(name)), action, env)
+			}
+			continue
+		}
+		av, err := prolog2av(action.Arg(1), env)
+		if err != nil {
+			return err
+		}
+		if action.Functor() == "delete" {
+			av = setOf(av)
+		}
+		if avType(av) != attr.typ {
+			return typeError(attr.typ, pair(name, av2prolog(av)), env)
+		}
+	}
+	return iter.Err()
+}
+
+// avType returns the type of av as used by dynamo_schema/2, such as n or ss.
+func avType(av *dynamodb.AttributeValue) engine.Atom {
+	switch {
+	case av.S != nil:
+		return "s"
+	case av.N != nil:
+		return "n"
+	case av.B != nil:
+		return "b"
+	case av.BOOL != nil:
+		return "bool"
+	case av.NULL != nil:
+		return "null"
+	case av.SS != nil:
+		return "ss"
+	case av.NS != nil:
+		return "ns"
+	case av.BS != nil:
+		return "bs"
+	case av.L != nil:
+		return "l"
+	case av.M != nil:
+		return "m"
+	}
+	return ""
+}
@@ -2,10 +2,9 @@ package dynamodb
 
 import (
 	"encoding/base64"
-	"fmt"
+	"math/big"
 	"sort"
 	"strconv"
-	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -20,12 +19,12 @@ func av2prolog(av *dynamodb.AttributeValue) engine.Term {
 		enc := base64.StdEncoding.EncodeToString(av.B)
 		return engine.Atom("b").Apply(engine.Atom(enc))
 	case av.BS != nil:
-		list := make([]engine.Term, 0, len(av.L))
+		list := make([]engine.Term, 0, len(av.BS))
 		for _, v := range av.BS {
 			enc := base64.StdEncoding.EncodeToString(v)
-			list = append(list, engine.Atom("s").Apply(engine.Atom(enc)))
+			list = append(list, engine.Atom("b").Apply(engine.Atom(enc)))
 		}
-		return engine.Atom("ss").Apply(engine.List(list...))
+		return engine.Atom("bs").Apply(engine.List(list...))
 	case av.BOOL != nil:
 		bool := engine.Atom("false")
 		if *av.BOOL {
@@ -49,7 +48,7 @@ func av2prolog(av *dynamodb.AttributeValue) engine.Term {
 	case av.N != nil:
 		return engine.Atom("n").Apply(engine.Atom(*av.N))
 	case av.NS != nil:
-		list := make([]engine.Term, 0, len(av.L))
+		list := make([]engine.Term, 0, len(av.NS))
 		for _, v := range av.NS {
 			list = append(list, engine.Atom("n").Apply(engine.Atom(*v)))
 		}
@@ -59,7 +58,7 @@ func av2prolog(av *dynamodb.AttributeValue) engine.Term {
 	case av.S != nil:
 		return engine.Atom("s").Apply(engine.Atom(*av.S))
 	case av.SS != nil:
-		list := make([]engine.Term, 0, len(av.L))
+		list := make([]engine.Term, 0, len(av.SS))
 		for _, v := range av.SS {
 			list = append(list, engine.Atom("s").Apply(engine.Atom(*v)))
 		}
@@ -70,7 +69,7 @@ func av2prolog(av *dynamodb.AttributeValue) engine.Term {
 
 func sortTerms(list []engine.Term, env *engine.Env) {
 	sort.Slice(list, func(i, j int) bool {
-		return env.Compare(list[i], list[j]) < 0
+		return env.Compare(list[i], list[j]) == engine.OrderLess
 	})
 }
 
@@ -79,6 +78,24 @@ func item2prolog(item map[string]*dynamodb.AttributeValue) engine.Term {
 	return t.Arg(0)
 }
 
+// plainItem is like item2prolog but simplifies every value.
+func plainItem(item map[string]*dynamodb.AttributeValue) (engine.Term, error) {
+	list := make([]engine.Term, 0, len(item))
+	iter := engine.ListIterator{List: item2prolog(item)}
+	for iter.Next() {
+		key, val, err := splitkey(iter.Current(), nil)
+		if err != nil {
+			return nil, err
+		}
+		sv, err := simplify(val, nil)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, engine.Atom("-").Apply(engine.Atom(key), sv))
+	}
+	return engine.List(list...), iter.Err()
+}
+
 func splitkey(t engine.Term, env *engine.Env) (key string, value engine.Term, err error) {
 	switch t := env.Resolve(t).(type) {
 	case engine.Variable:
@@ -102,52 +119,6 @@ func splitkey(t engine.Term, env *engine.Env) (key string, value engine.Term, er
 	return "", nil, engine.TypeError(engine.ValidTypePair, t, env)
 }
 
-// type keys struct {
-// 	pk, sk      string
-// 	pv, sv, sv2 *dynamodb.AttributeValue
-// 	op          dynamo.Operator
-// }
-
-// func keyspec(table dynamo.Table, t engine.Term, env *engine.Env) (*dynamo.Query, error) {
-// 	switch t := env.Resolve(t).(type) {
-// 	case engine.Variable:
-// 		return nil, engine.InstantiationError(env)
-// 	case *engine.Compound:
-// 		if t.Functor == "-" && len(t.Args) == 2 {
-// 			name, value, err := parsekey(t, env)
-// 			if err != nil {
-// 				return nil, err
-// 			}
-// 			q := table.Get(name, value)
-// 			return q, nil
-// 		}
-
-// 		switch {
-// 		case t.Functor == "-" && len(t.Args) == 2:
-// 			name, value, err := parsekey(t, env)
-// 			if err != nil {
-// 				return nil, err
-// 			}
-// 			q := table.Get(name, value)
-// 			return q, nil
-// 		case t.Functor == "-&-" && len(t.Args) == 2,
-// 			t.Functor == "key" && len(t.Args) == 2:
-// 			pk, pv, err := parsekey(t.Args[0], env)
-// 			if err != nil {
-// 				return nil, err
-// 			}
-// 			sk, sv, err := parsekey(t.Args[1], env)
-// 			if err != nil {
-// 				return nil, err
-// 			}
-// 		}
-
-// 		// TODO: better error
-// 		return nil, engine.TypeError(engine.ValidTypeCompound, t, env)
-// 	}
-// 	return nil, engine.TypeError(engine.ValidTypePair, t, env)
-// }
-
 func splitkeys(t engine.Term, env *engine.Env) (pk, rk engine.Term, err error) {
 	switch t := env.Resolve(t).(type) {
 	case engine.Variable:
@@ -187,11 +158,14 @@ func prolog2av(v engine.Term, env *engine.Env) (*dynamodb.AttributeValue, error)
 	case engine.Variable:
 		return nil, engine.InstantiationError(env)
 	case engine.Atom:
+		if v == "[]" {
+			return &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}, nil
+		}
 		return &dynamodb.AttributeValue{S: aws.String(string(v))}, nil
 	case engine.Integer:
 		return &dynamodb.AttributeValue{N: aws.String(string(strconv.FormatInt(int64(v), 10)))}, nil
 	case engine.Float:
-		return &dynamodb.AttributeValue{N: aws.String(string(strconv.FormatFloat(float64(v), 'f', -1, 64)))}, nil
+		return &dynamodb.AttributeValue{N: aws.String(formatFloat(v))}, nil
 	case engine.Compound:
 		arg := env.Resolve(v.Arg(0))
 		switch v.Functor() {
@@ -199,7 +173,7 @@ func prolog2av(v engine.Term, env *engine.Env) (*dynamodb.AttributeValue, error)
 			if a, ok := arg.(engine.Atom); ok {
 				b, err := base64.StdEncoding.DecodeString(string(a))
 				if err != nil {
-					return nil, err
+					return nil, domainError("base64", a, env)
 				}
 				return &dynamodb.AttributeValue{B: b}, nil
 			}
@@ -208,17 +182,15 @@ func prolog2av(v engine.Term, env *engine.Env) (*dynamodb.AttributeValue, error)
 			av := &dynamodb.AttributeValue{BS: [][]byte{}}
 			iter := engine.ListIterator{List: arg, Env: env}
 			for iter.Next() {
-				elem := iter.Current()
-				switch elem := env.Resolve(elem).(type) {
-				case engine.Atom:
-					b, err := base64.StdEncoding.DecodeString(string(elem))
-					if err != nil {
-						return nil, err
-					}
-					av.BS = append(av.BS, b)
-				default:
-					return nil, engine.TypeError(engine.ValidTypeAtom, elem, env)
+				enc, err := setElem(iter.Current(), "b", env)
+				if err != nil {
+					return nil, err
+				}
+				b, err := base64.StdEncoding.DecodeString(enc)
+				if err != nil {
+					return nil, domainError("base64", engine.Atom(enc), env)
 				}
+				av.BS = append(av.BS, b)
 			}
 			return av, iter.Err()
 		case "bool":
@@ -229,7 +201,7 @@ func prolog2av(v engine.Term, env *engine.Env) (*dynamodb.AttributeValue, error)
 				case "false":
 					return &dynamodb.AttributeValue{BOOL: aws.Bool(false)}, nil
 				default:
-					return nil, fmt.Errorf("must be true or false, got: %v", a)
+					return nil, domainError("boolean", a, env)
 				}
 			}
 			return nil, engine.TypeError(engine.ValidTypeAtom, arg, env)
@@ -240,31 +212,32 @@ func prolog2av(v engine.Term, env *engine.Env) (*dynamodb.AttributeValue, error)
 		case "n":
 			switch x := arg.(type) {
 			case engine.Atom:
+				if !isNumber(string(x)) {
+					return nil, domainError("number", x, env)
+				}
 				return &dynamodb.AttributeValue{N: aws.String(string(x))}, nil
 			case engine.Integer:
 				return &dynamodb.AttributeValue{N: aws.String(string(strconv.FormatInt(int64(x), 10)))}, nil
 			case engine.Float:
-				return &dynamodb.AttributeValue{N: aws.String(string(strconv.FormatFloat(float64(x), 'f', 64, 64)))}, nil
+				return &dynamodb.AttributeValue{N: aws.String(formatFloat(x))}, nil
 			}
 			return nil, engine.TypeError(engine.ValidTypeAtom, arg, env)
 		case "ns":
 			av := &dynamodb.AttributeValue{NS: []*string{}}
 			iter := engine.ListIterator{List: arg, Env: env}
 			for iter.Next() {
-				elem := iter.Current()
-				switch elem := env.Resolve(elem).(type) {
-				case engine.Atom:
-					av.NS = append(av.NS, aws.String(string(elem)))
-				default:
-					return nil, engine.TypeError(engine.ValidTypeAtom, elem, env)
+				n, err := setElem(iter.Current(), "n", env)
+				if err != nil {
+					return nil, err
 				}
+				av.NS = append(av.NS, aws.String(n))
 			}
 			return av, iter.Err()
 		case "null":
 			if a, ok := arg.(engine.Atom); ok && a == "true" {
 				return &dynamodb.AttributeValue{NULL: aws.Bool(true)}, nil
 			}
-			return nil, fmt.Errorf("must be true")
+			return nil, domainError("attribute_value", v, env)
 		case "s":
 			if a, ok := arg.(engine.Atom); ok {
 				return &dynamodb.AttributeValue{S: aws.String(string(a))}, nil
@@ -274,31 +247,96 @@ func prolog2av(v engine.Term, env *engine.Env) (*dynamodb.AttributeValue, error)
 			av := &dynamodb.AttributeValue{SS: []*string{}}
 			iter := engine.ListIterator{List: arg, Env: env}
 			for iter.Next() {
-				elem := iter.Current()
-				switch elem := env.Resolve(elem).(type) {
-				case engine.Atom:
-					av.SS = append(av.SS, aws.String(string(elem)))
-				default:
-					return nil, engine.TypeError(engine.ValidTypeAtom, elem, env)
+				str, err := setElem(iter.Current(), "s", env)
+				if err != nil {
+					return nil, err
 				}
+				av.SS = append(av.SS, aws.String(str))
 			}
 			return av, iter.Err()
+		case "set":
+			return makeset(arg, env)
 
 		case ".":
 			// prolog list
 			// try to figure out if it's a M like [foo-bar] or L like [foo]
 			// TODO: maybe this is dumb idk
-			if internal.IsMap(arg, env) {
+			if internal.IsMap(v, env) {
 				return makemap(v, env)
 			}
 			return makelist(v, env)
 		default:
-			return nil, fmt.Errorf("invalid value")
+			return nil, domainError("attribute_value", v, env)
 		}
 	}
 	return nil, engine.TypeError(engine.ValidTypeCompound, v, env)
 }
 
+// setElem returns the text of a set element, which can be plain or wrapped in the set's type, like a or s(a).
+func setElem(t engine.Term, typ engine.Atom, env *engine.Env) (string, error) {
+	switch elem := env.Resolve(t).(type) {
+	case engine.Variable:
+		return "", engine.InstantiationError(env)
+	case engine.Atom:
+		return string(elem), nil
+	case engine.Integer:
+		if typ == "n" {
+			return strconv.FormatInt(int64(elem), 10), nil
+		}
+	case engine.Float:
+		if typ == "n" {
+			return formatFloat(elem), nil
+		}
+	case engine.Compound:
+		if elem.Functor() == typ && elem.Arity() == 1 {
+			if arg, ok := env.Resolve(elem.Arg(0)).(engine.Compound); ok {
+				return "", engine.TypeError(engine.ValidTypeAtom, arg, env)
+			}
+			return setElem(elem.Arg(0), typ, env)
+		}
+	}
+	return "", engine.TypeError(engine.ValidTypeAtom, t, env)
+}
+
+// makeset converts the elements of set(List) to a string, number, or binary set, depending on the type of the first element:
+// atoms or s(Atom) for strings, numbers or n(Number) for numbers, and b(Base64) for binary.
+// Sets can't be empty.
+func makeset(arg engine.Term, env *engine.Env) (*dynamodb.AttributeValue, error) {
+	var first engine.Term
+	switch list := env.Resolve(arg).(type) {
+	case engine.Variable:
+		return nil, engine.InstantiationError(env)
+	case engine.Compound:
+		if list.Functor() == "." && list.Arity() == 2 {
+			first = env.Resolve(list.Arg(0))
+		}
+	}
+	if first == nil {
+		return nil, domainError("non_empty_list", arg, env)
+	}
+
+	var typ engine.Atom
+	switch elem := first.(type) {
+	case engine.Variable:
+		return nil, engine.InstantiationError(env)
+	case engine.Atom:
+		typ = "s"
+	case engine.Integer, engine.Float:
+		typ = "n"
+	case engine.Compound:
+		switch elem.Functor() {
+		case "s", "n", "b":
+			if elem.Arity() == 1 {
+				typ = elem.Functor()
+			}
+		}
+	}
+	if typ == "" {
+		return nil, engine.TypeError(engine.ValidTypeAtom, first, env)
+	}
+	return prolog2av((typ + "s").Apply(arg), env)
+}
+
 func makemap(arg engine.Term, env *engine.Env) (*dynamodb.AttributeValue, error) {
 	av := &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{}}
 	iter := engine.ListIterator{List: arg, Env: env}
@@ -357,6 +395,10 @@ func simplify(v engine.Term, env *engine.Env) (engine.Term, error) {
 			}
 			return engine.List(list...), iter.Err()
 		case "m":
+			if arg == engine.Atom("[]") {
+				// keep empty maps distinct from empty lists
+				return v, nil
+			}
 			list := make([]engine.Term, 0)
 			iter := engine.ListIterator{List: arg, Env: env}
 			for iter.Next() {
@@ -376,19 +418,15 @@ func simplify(v engine.Term, env *engine.Env) (engine.Term, error) {
 		case "n":
 			switch x := arg.(type) {
 			case engine.Atom:
-				// TODO: make this an option instead
-				if strings.ContainsRune(string(x), '.') {
-					f, err := strconv.ParseFloat(string(x), 64)
-					if err != nil {
-						return nil, err // TODO: wrap error?
-					}
-					return engine.Float(f), nil
+				n, ok := number(string(x))
+				if !ok {
+					return nil, domainError("number", x, env)
 				}
-				n, err := strconv.ParseInt(string(x), 10, 64)
-				if err != nil {
-					return nil, err
+				if n == nil {
+					// can't be represented exactly
+					return v, nil
 				}
-				return engine.Integer(n), nil
+				return n, nil
 			case engine.Integer:
 				return engine.Integer(x), nil
 			case engine.Float:
@@ -397,9 +435,46 @@ func simplify(v engine.Term, env *engine.Env) (engine.Term, error) {
 			return nil, engine.TypeError(engine.ValidTypeAtom, arg, env)
 		case "s":
 			if a, ok := arg.(engine.Atom); ok {
+				if a == "[]" {
+					// keep '[]' distinct from empty lists
+					return v, nil
+				}
 				return engine.Atom(a), nil
 			}
 			return nil, engine.TypeError(engine.ValidTypeAtom, arg, env)
+		case "ss", "ns", "bs":
+			list := make([]engine.Term, 0)
+			iter := engine.ListIterator{List: arg, Env: env}
+			for iter.Next() {
+				switch v.Functor() {
+				case "ss":
+					// elements can't be confused with lists, so '[]' doesn't need s('[]')
+					str, err := setElem(iter.Current(), "s", env)
+					if err != nil {
+						return nil, err
+					}
+					list = append(list, engine.Atom(str))
+					continue
+				case "bs":
+					// binary elements keep their wrapper, so binary sets stay distinct from string sets
+					enc, err := setElem(iter.Current(), "b", env)
+					if err != nil {
+						return nil, err
+					}
+					list = append(list, engine.Atom("b").Apply(engine.Atom(enc)))
+					continue
+				}
+				val, err := simplify(iter.Current(), env)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, val)
+			}
+			if err := iter.Err(); err != nil {
+				return nil, err
+			}
+			sortTerms(list, env)
+			return engine.Atom("set").Apply(engine.List(list...)), nil
 		default:
 			return v, nil
 		}
@@ -407,6 +482,37 @@ func simplify(v engine.Term, env *engine.Env) (engine.Term, error) {
 	return nil, engine.TypeError(engine.ValidTypeCompound, v, env)
 }
 
+// number converts the text of a DynamoDB number into a Prolog number without losing precision.
+// Integral numbers become integers and others become floats, as long as the conversion is exact.
+// It returns nil if the number can't be represented exactly (such as integers beyond 64 bits
+// or decimals with more precision than a float), and false if text isn't a number.
+func number(text string) (engine.Term, bool) {
+	if !isNumber(text) {
+		return nil, false
+	}
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, false
+	}
+	if r.IsInt() {
+		if !r.Num().IsInt64() {
+			return nil, true
+		}
+		return engine.Integer(r.Num().Int64()), true
+	}
+	f, _ := r.Float64()
+	back, ok := new(big.Rat).SetString(formatFloat(engine.Float(f)))
+	if !ok || back.Cmp(r) != 0 {
+		return nil, true
+	}
+	return engine.Float(f), true
+}
+
+// formatFloat formats f for DynamoDB using the fewest digits that represent it exactly.
+func formatFloat(f engine.Float) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 64)
+}
+
 func list2item(list engine.Term, env *engine.Env) (map[string]*dynamodb.AttributeValue, error) {
 	avs := make(map[string]*dynamodb.AttributeValue)
 	iter := engine.ListIterator{List: env.Resolve(list), Env: env}
@@ -421,10 +527,14 @@ func list2item(list engine.Term, env *engine.Env) (map[string]*dynamodb.Attribut
 	return avs, iter.Err()
 }
 
-func tableName(table engine.Term) (string, error) {
-	switch table := table.(type) {
+// tableName returns the name of the table t, which must be an atom.
+func tableName(t engine.Term, env *engine.Env) (string, error) {
+	switch t := env.Resolve(t).(type) {
+	case engine.Variable:
+		return "", engine.InstantiationError(env)
 	case engine.Atom:
-		return string(table), nil
+		return string(t), nil
+	default:
+		return "", engine.TypeError(engine.ValidTypeAtom, t, env)
 	}
-	return "", engine.InstantiationError(nil)
 }
@@ -0,0 +1,303 @@
+package dynamodb
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ichiban/prolog/engine"
+)
+
+// randomValue is a random attribute value of any of the ten DynamoDB types, for testing/quick.
+type randomValue struct {
+	av *dynamodb.AttributeValue
+}
+
+func (randomValue) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(randomValue{av: randomAV(r, 3)})
+}
+
+func (v randomValue) String() string {
+	return v.av.String()
+}
+
+var randomStrings = []string{"", "a", "b", "hello world", "[]", "42", "true", "null", "it's", "ünïcode", "k-v", "é"}
+
+func randomString(r *rand.Rand) string {
+	if r.Intn(2) == 0 {
+		return randomStrings[r.Intn(len(randomStrings))]
+	}
+	b := make([]byte, 1+r.Intn(8))
+	for i := range b {
+		b[i] = byte('a' + r.Intn(26))
+	}
+	return string(b)
+}
+
+func randomNumber(r *rand.Rand) string {
+	switch r.Intn(7) {
+	case 0:
+		return strconv.Itoa(r.Intn(100))
+	case 1:
+		return strconv.FormatInt(-r.Int63(), 10)
+	case 2:
+		return strconv.FormatFloat(r.Float64()*1000-500, 'f', -1, 64)
+	case 3:
+		// too big for an int64
+		return "1234567890123456789012345" + strconv.Itoa(r.Intn(10))
+	case 4:
+		// too precise for a float64
+		return "0.123456789012345678901234" + strconv.Itoa(1+r.Intn(9))
+	case 5:
+		return strconv.Itoa(r.Intn(10)) + ".0"
+	default:
+		return strconv.Itoa(1+r.Intn(9)) + "e" + strconv.Itoa(r.Intn(5))
+	}
+}
+
+func randomBytes(r *rand.Rand) []byte {
+	b := make([]byte, 1+r.Intn(6))
+	r.Read(b)
+	return b
+}
+
+func randomAV(r *rand.Rand, depth int) *dynamodb.AttributeValue {
+	types := 10
+	if depth == 0 {
+		// no more lists or maps
+		types = 8
+	}
+	// sets are non-empty and have no duplicates
+	n := 1 + r.Intn(4)
+	switch r.Intn(types) {
+	case 0:
+		return &dynamodb.AttributeValue{S: aws.String(randomString(r))}
+	case 1:
+		return &dynamodb.AttributeValue{N: aws.String(randomNumber(r))}
+	case 2:
+		return &dynamodb.AttributeValue{B: randomBytes(r)}
+	case 3:
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(r.Intn(2) == 0)}
+	case 4:
+		return &dynamodb.AttributeValue{NULL: aws.Bool(true)}
+	case 5:
+		av := &dynamodb.AttributeValue{}
+		seen := make(map[string]bool)
+		for i := 0; i < n; i++ {
+			if s := randomString(r); s != "" && !seen[s] {
+				seen[s] = true
+				av.SS = append(av.SS, aws.String(s))
+			}
+		}
+		if av.SS == nil {
+			av.SS = aws.StringSlice([]string{"x"})
+		}
+		return av
+	case 6:
+		av := &dynamodb.AttributeValue{}
+		seen := make(map[string]bool)
+		for i := 0; i < n; i++ {
+			num := randomNumber(r)
+			if key := canonicalNumber(num); !seen[key] {
+				seen[key] = true
+				av.NS = append(av.NS, aws.String(num))
+			}
+		}
+		return av
+	case 7:
+		av := &dynamodb.AttributeValue{}
+		seen := make(map[string]bool)
+		for i := 0; i < n; i++ {
+			if b := randomBytes(r); !seen[string(b)] {
+				seen[string(b)] = true
+				av.BS = append(av.BS, b)
+			}
+		}
+		return av
+	case 8:
+		av := &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+		for i := r.Intn(4); i > 0; i-- {
+			av.L = append(av.L, randomAV(r, depth-1))
+		}
+		return av
+	default:
+		av := &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{}}
+		for i := r.Intn(4); i > 0; i-- {
+			av.M[randomString(r)] = randomAV(r, depth-1)
+		}
+		return av
+	}
+}
+
+func canonicalNumber(n string) string {
+	r, ok := new(big.Rat).SetString(n)
+	if !ok {
+		panic("invalid number: " + n)
+	}
+	return r.RatString()
+}
+
+// canonical returns a string that is equal for attribute values that DynamoDB considers equal,
+// ignoring the formatting of numbers and the order of set elements.
+func canonical(av *dynamodb.AttributeValue) string {
+	set := func(typ string, elems []string) string {
+		sort.Strings(elems)
+		return typ + "{" + strings.Join(elems, ",") + "}"
+	}
+	switch {
+	case av.S != nil:
+		return strconv.Quote(*av.S)
+	case av.N != nil:
+		return canonicalNumber(*av.N)
+	case av.B != nil:
+		return fmt.Sprintf("b%x", av.B)
+	case av.BOOL != nil:
+		return strconv.FormatBool(*av.BOOL)
+	case av.NULL != nil:
+		return "null"
+	case av.SS != nil:
+		elems := make([]string, 0, len(av.SS))
+		for _, s := range av.SS {
+			elems = append(elems, strconv.Quote(*s))
+		}
+		return set("ss", elems)
+	case av.NS != nil:
+		elems := make([]string, 0, len(av.NS))
+		for _, n := range av.NS {
+			elems = append(elems, canonicalNumber(*n))
+		}
+		return set("ns", elems)
+	case av.BS != nil:
+		elems := make([]string, 0, len(av.BS))
+		for _, b := range av.BS {
+			elems = append(elems, fmt.Sprintf("%x", b))
+		}
+		return set("bs", elems)
+	case av.L != nil:
+		elems := make([]string, 0, len(av.L))
+		for _, v := range av.L {
+			elems = append(elems, canonical(v))
+		}
+		return "[" + strings.Join(elems, ",") + "]"
+	case av.M != nil:
+		elems := make([]string, 0, len(av.M))
+		for k, v := range av.M {
+			elems = append(elems, strconv.Quote(k)+":"+canonical(v))
+		}
+		return set("m", elems)
+	}
+	return "?"
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	// attribute values converted to Prolog and back are unchanged
+	tagged := func(v randomValue) bool {
+		back, err := prolog2av(av2prolog(v.av), nil)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		if diff := cmp.Diff(v.av, back); diff != "" {
+			t.Log(diff)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(tagged, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error("av2prolog:", err)
+	}
+
+	// simplified values convert back to equal attribute values, as in attribute_value/2
+	plain := func(v randomValue) bool {
+		simple, err := simplify(av2prolog(v.av), nil)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		back, err := prolog2av(simple, nil)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		if want, got := canonical(v.av), canonical(back); want != got {
+			t.Log("want:", want, "got:", got)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(plain, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error("simplify:", err)
+	}
+}
+
+func TestSimplifySets(t *testing.T) {
+	// sets are sorted and unambiguous, so simplifying them again changes nothing
+	sorted := func(v randomValue) bool {
+		simple, err := simplify(av2prolog(v.av), nil)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		set, ok := simple.(engine.Compound)
+		if !ok || set.Functor() != "set" {
+			return true
+		}
+		var elems []engine.Term
+		iter := engine.ListIterator{List: set.Arg(0)}
+		for iter.Next() {
+			elems = append(elems, iter.Current())
+		}
+		for i := 1; i < len(elems); i++ {
+			if (*engine.Env)(nil).Compare(elems[i-1], elems[i]) != engine.OrderLess {
+				t.Log("not sorted:", elems)
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(sorted, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+
+	tests := []struct {
+		name string
+		av   *dynamodb.AttributeValue
+		want engine.Term
+	}{
+		{
+			name: "strings",
+			av:   &dynamodb.AttributeValue{SS: aws.StringSlice([]string{"b", "[]", "a"})},
+			want: engine.Atom("set").Apply(engine.List(engine.Atom("[]"), engine.Atom("a"), engine.Atom("b"))),
+		},
+		{
+			name: "numbers",
+			av:   &dynamodb.AttributeValue{NS: aws.StringSlice([]string{"10", "0.5", "12345678901234567890"})},
+			want: engine.Atom("set").Apply(engine.List(engine.Float(0.5), engine.Integer(10), engine.Atom("n").Apply(engine.Atom("12345678901234567890")))),
+		},
+		{
+			name: "binary",
+			av:   &dynamodb.AttributeValue{BS: [][]byte{{2}, {1, 2}}},
+			want: engine.Atom("set").Apply(engine.List(engine.Atom("b").Apply(engine.Atom("AQI=")), engine.Atom("b").Apply(engine.Atom("Ag==")))),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := simplify(av2prolog(test.av), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (*engine.Env)(nil).Compare(test.want, got) != engine.OrderEqual {
+				t.Errorf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}